@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"math"
 )
 
@@ -8,12 +9,26 @@ import (
 
 // CoocData - for storage later
 type CoocData struct {
-	Keys []int64
-	Vals []float32
+	Mode   string // what the keys are, see Cooc; absent from older files, which are plain.
+	Keys   []int64
+	Vals   []float32
+	Labels []string // label of each label code, for word-label coocs.
+	Reach  [2]int   // furthest offsets on the left and right, for positional coocs.
 }
 
 // LoadCoocData - load serialized data into it
 func (c *Cooc) LoadCoocData(d CoocData) {
+	c.checkMode(d.Mode)
+	if d.Mode == "positional" && len(d.Keys) > 0 {
+		c.checkReach(d.Reach)
+	}
+	if d.Mode == "label" {
+		recode := c.labelRecoder(d.Labels)
+		for i := 0; i < len(d.Keys); i++ {
+			c.Counter[recode(d.Keys[i])] += d.Vals[i]
+		}
+		return
+	}
 	for i := 0; i < len(d.Keys); i++ {
 		c.Counter[d.Keys[i]] += d.Vals[i]
 	}
@@ -21,13 +36,50 @@ func (c *Cooc) LoadCoocData(d CoocData) {
 
 /* Cooc struct for the primary extraction. */
 
-// Cooc - Cooccurrence counter.
+// Cooc - Cooccurrence counter. Its Mode says what its keys are: "" for the cantor pairing
+// of a word and its context, "left" and "right" for those of the contexts on one side,
+// "directional" for those of both sides, see DirectedKey, "positional" for those of
+// each offset, see PositionalKey, "structured" for the pairings of a word and a
+// context at an offset, see StructuredContext, "doc" and "termdoc" for document
+// contexts, see MakeDocumentWindow, and "label" for those of a word and a label code.
 type Cooc struct {
+	Mode    string
 	Counter map[int64]float32
+	Labels  []string // label of each label code.
+	Reach   [2]int   // furthest offsets counted on the left and right, for positional coocs.
+
+	labelCodes map[string]int
+}
+
+// Panics unless counts of the given mode can go into the Cooc; an empty one takes any mode.
+func (c *Cooc) checkMode(mode string) {
+	if len(c.Counter) == 0 {
+		c.Mode = mode
+	} else if c.Mode != mode {
+		panic(fmt.Sprintf("Cannot mix %q coocs with %q ones!", c.Mode, mode))
+	}
+}
+
+// Keeps the reach of a positional Cooc to the offsets that all of its counts go up to,
+// before counts with the given reach go into it; an empty one takes that reach.
+func (c *Cooc) checkReach(reach [2]int) {
+	if len(c.Counter) == 0 {
+		c.Reach = reach
+		return
+	}
+	for side := range reach {
+		if reach[side] < c.Reach[side] {
+			c.Reach[side] = reach[side]
+		}
+	}
 }
 
 func (c *Cooc) deepCopy() *Cooc {
 	c2 := ConstructCooc()
+	c2.Mode, c2.Reach = c.Mode, c.Reach
+	for _, label := range c.Labels {
+		c2.labelCode(label)
+	}
 	for cantor, count := range c.Counter {
 		c2.Counter[cantor] = count
 	}
@@ -36,6 +88,17 @@ func (c *Cooc) deepCopy() *Cooc {
 
 // Merge - Cooc c1 eats the input Cooc, c2
 func (c *Cooc) Merge(c2 *Cooc) {
+	c.checkMode(c2.Mode)
+	if c2.Mode == "positional" && len(c2.Counter) > 0 {
+		c.checkReach(c2.Reach)
+	}
+	if c2.Mode == "label" {
+		recode := c.labelRecoder(c2.Labels)
+		for key, count := range c2.Counter {
+			c.Counter[recode(key)] += count
+		}
+		return
+	}
 	for cantor, count := range c2.Counter {
 		c.Counter[cantor] += count
 	}
@@ -48,13 +111,52 @@ func (c *Cooc) AddAll(tids []int, cids []int, weight float32) {
 	if len(cids) < size {
 		size = len(cids)
 	}
-	// Iterate over all of them and add up!
+	// Iterate over all of them and add up, skipping the gaps!
 	for i := 0; i < size; i++ {
+		if tids[i] < 0 || cids[i] < 0 {
+			continue
+		}
 		cantor := CantorPairing(int64(tids[i]), int64(cids[i]))
 		c.Counter[cantor] += weight
 	}
 }
 
+// DirectedKey - the key of a word and a context on its left or on its right.
+func DirectedKey(cantor int64, right bool) int64 {
+	if right {
+		return cantor<<1 | 1
+	}
+	return cantor << 1
+}
+
+// Like AddAll, but keeping apart the contexts on the left and on the right.
+func (c *Cooc) addAllDirected(tids []int, cids []int, weight float32, right bool) {
+	for i := 0; i < len(tids) && i < len(cids); i++ {
+		if tids[i] < 0 || cids[i] < 0 {
+			continue
+		}
+		c.Counter[DirectedKey(CantorPairing(int64(tids[i]), int64(cids[i])), right)] += weight
+	}
+}
+
+// SplitDirections - splits a directional Cooc into a "left" one with the contexts on the
+// left of words, and a "right" one with those on their right.
+func SplitDirections(c *Cooc) (*Cooc, *Cooc) {
+	if c.Mode != "directional" {
+		panic("Can only split directional coocs!")
+	}
+	left, right := ConstructCooc(), ConstructCooc()
+	left.Mode, right.Mode = "left", "right"
+	for key, count := range c.Counter {
+		if key&1 == 1 {
+			right.Counter[key>>1] = count
+		} else {
+			left.Counter[key>>1] = count
+		}
+	}
+	return left, right
+}
+
 // ConstructCooc constructor
 func ConstructCooc() *Cooc {
 	cooc := Cooc{
@@ -72,18 +174,53 @@ func CantorPairing(k1, k2 int64) int64 {
 // InverseCantor - gets back the original pair
 func InverseCantor(cantor int64) (k1, k2 int) {
 	z := float64(cantor)
-	w := math.Floor(0.5 * (math.Sqrt(8*z+1) - 1))
+	w := int64(math.Floor(0.5 * (math.Sqrt(8*z+1) - 1)))
+	// The square root is only approximate for the huge pairings of structured contexts.
+	for w > 0 && (w*w+w)/2 > cantor {
+		w--
+	}
+	for ((w+1)*(w+1)+w+1)/2 <= cantor {
+		w++
+	}
 	t := (w*w + w) / 2
 
 	// k2 is defined first
-	k2 = int(z - t)
-	k1 = int(int(w) - k2)
+	k2 = int(cantor - t)
+	k1 = int(w) - k2
 	return
 }
 
 // ExtractCooc - extracts cooccurrence statistics from an encoded document.
 func ExtractCooc(encodedDoc []int, win Window) *Cooc {
 	cooc := ConstructCooc()
+	cooc.AddDoc(encodedDoc, win)
+	return cooc
+}
+
+// AddDoc - adds the cooccurrence statistics of an encoded document to the Cooc.
+// A sampled window draws its sizes as for the first document of the corpus, see AddSentence.
+func (c *Cooc) AddDoc(encodedDoc []int, win Window) {
+	c.AddSentence(encodedDoc, 0, 0, win)
+}
+
+// AddSentence - adds the cooccurrence statistics of the sent-th sentence of the document
+// with ID docID like AddDoc, drawing the sizes of a sampled window from the random numbers
+// of its place in the corpus.
+func (c *Cooc) AddSentence(encodedDoc []int, docID int64, sent int, win Window) {
+	c.checkMode(win.CoocMode())
+	if win.sampled {
+		c.addSampled(encodedDoc, seedFromPlace(win.seed, docID, sent), win)
+		return
+	}
+	if win.positional {
+		c.checkReach([2]int{len(win.lWeights), len(win.rWeights)})
+		c.addPositional(encodedDoc, win)
+		return
+	}
+	if win.structured {
+		c.addStructured(encodedDoc, win)
+		return
+	}
 	lstart, lend := win.GetLeftStartEnd()
 	for i := lstart; i < lend; i++ {
 		weight := win.lWeights[i]
@@ -91,7 +228,11 @@ func ExtractCooc(encodedDoc []int, win Window) *Cooc {
 			offset := i + 1
 			terms := encodedDoc[offset:]
 			conts := encodedDoc[:len(encodedDoc)-offset]
-			cooc.AddAll(terms, conts, weight)
+			if win.directional {
+				c.addAllDirected(terms, conts, weight, false)
+			} else {
+				c.AddAll(terms, conts, weight)
+			}
 		}
 	}
 	rstart, rend := win.GetRightStartEnd()
@@ -101,8 +242,56 @@ func ExtractCooc(encodedDoc []int, win Window) *Cooc {
 			offset := i + 1
 			terms := encodedDoc[:len(encodedDoc)-offset]
 			conts := encodedDoc[offset:]
-			cooc.AddAll(terms, conts, weight)
+			if win.directional {
+				c.addAllDirected(terms, conts, weight, true)
+			} else {
+				c.AddAll(terms, conts, weight)
+			}
 		}
 	}
-	return cooc
+}
+
+// Adds the contexts of each word within a window size drawn for it, see Window.SetSampled.
+func (c *Cooc) addSampled(encodedDoc []int, rng splitMix, win Window) {
+	for i, term := range encodedDoc {
+		b := 1 + int(rng.next()%uint64(win.size))
+		if term < 0 {
+			continue
+		}
+		for offset := 1; offset <= b; offset++ {
+			if i-offset >= 0 && encodedDoc[i-offset] >= 0 {
+				cantor := CantorPairing(int64(term), int64(encodedDoc[i-offset]))
+				if win.directional {
+					cantor = DirectedKey(cantor, false)
+				}
+				c.Counter[cantor] += win.unit
+			}
+			if i+offset < len(encodedDoc) && encodedDoc[i+offset] >= 0 {
+				cantor := CantorPairing(int64(term), int64(encodedDoc[i+offset]))
+				if win.directional {
+					cantor = DirectedKey(cantor, true)
+				}
+				c.Counter[cantor] += win.unit
+			}
+		}
+	}
+}
+
+// AddSentences - adds the cooccurrence statistics of a document of encoded sentences, with
+// the given document ID, see AddSentence.
+// Contexts within a sentence get the window weights, and contexts across sentences get
+// those weights times the window's cross-sentence weight.
+func (c *Cooc) AddSentences(sents [][]int, docID int64, win Window) {
+	if len(sents) > 1 && win.cross > 0 {
+		// Every pair gets the cross weight, then pairs within a sentence are topped up.
+		var doc []int
+		for _, sent := range sents {
+			doc = append(doc, sent...)
+		}
+		c.AddSentence(doc, docID, -1, win.scaled(win.cross))
+		win = win.scaled(1 - win.cross)
+	}
+	for i, sent := range sents {
+		c.AddSentence(sent, docID, i, win)
+	}
 }
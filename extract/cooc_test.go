@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"math"
+	"path/filepath"
 	"testing"
 )
 
@@ -59,3 +61,273 @@ func TestCoocMerge(t *testing.T) {
 		}
 	}
 }
+
+func TestStreamingCoocExtraction(t *testing.T) {
+	l := ConstructLogger("silent")
+	documents := LoadSampleWords()
+	u := ExtractUnigram(documents)
+	win := MakeWindow(3, "")
+
+	// Extracting doc by doc in memory should give what the workers stream.
+	expected := ConstructCooc()
+	for _, doc := range UnigramEncode(u, documents) {
+		expected.AddDoc(doc, *win)
+	}
+	c := CoocExtraction(ConstructCorpus([]string{"../data/test_data/sample.txt.gz"}), ConstructParser(), u, win, l)
+	if len(c.Counter) != len(expected.Counter) {
+		t.Errorf("Streamed %d cooc pairs but expected %d!\n", len(c.Counter), len(expected.Counter))
+	}
+	for cantor, count := range expected.Counter {
+		if math.Abs(float64(c.Counter[cantor]-count)) > 1e-3 {
+			t.Errorf("Different count for cantor %d: %f vs %f\n", cantor, c.Counter[cantor], count)
+		}
+	}
+}
+
+func TestAddSentences(t *testing.T) {
+	sents := [][]int{{1, 2}, {3, 4}}
+	win := MakeWindow(1, "")
+
+	// Without a cross weight the window stops at the end of a sentence.
+	c := ConstructCooc()
+	c.AddSentences(sents, 0, *win)
+	if len(c.Counter) != 4 || c.Counter[CantorPairing(2, 3)] != 0 {
+		t.Errorf("Window crossed a sentence boundary! Got %v\n", c.Counter)
+	}
+
+	win.SetCrossWeight(0.5)
+	c = ConstructCooc()
+	c.AddSentences(sents, 0, *win)
+	within, across := c.Counter[CantorPairing(1, 2)], c.Counter[CantorPairing(2, 3)]
+	if math.Abs(float64(within)-1) > 1e-6 || math.Abs(float64(across)-0.5) > 1e-6 {
+		t.Errorf("Expected weights 1 within and 0.5 across, got %f and %f\n", within, across)
+	}
+}
+
+func TestStopwords(t *testing.T) {
+	u := ExtractUnigram([][]string{{"the", "cat", "sat", "on", "the", "mat"}})
+	doc := []string{"the", "cat", "sat", "on", "the", "mat", "dog"}
+	cat, sat, mat := u.encoder["cat"], u.encoder["sat"], u.encoder["mat"]
+	win := MakeWindow(2, "")
+
+	// Clean windows reach past the stopwords.
+	u.SetStopwords(LoadStopwords("english"), "clean")
+	if codes := u.EncodeDoc(doc); len(codes) != 3 {
+		t.Errorf("Expected cat sat mat but got %v\n", codes)
+	}
+	c := ExtractCooc(u.EncodeDoc(doc), *win)
+	if c.Counter[CantorPairing(int64(sat), int64(mat))] != 1 {
+		t.Errorf("Clean window should see mat right after sat, got %v\n", c.Counter)
+	}
+
+	// Dirty windows leave gaps, so mat is 3 words away from sat.
+	u.SetStopwords(LoadStopwords("english"), "dirty")
+	codes := u.EncodeDoc(doc)
+	if len(codes) != 6 || codes[0] != GAPCODE || codes[3] != GAPCODE {
+		t.Errorf("Expected gaps in place of the stopwords, got %v\n", codes)
+	}
+	c = ExtractCooc(codes, *win)
+	if len(c.Counter) != 2 || c.Counter[CantorPairing(int64(cat), int64(sat))] != 1 {
+		t.Errorf("Dirty window should only see cat and sat together, got %v\n", c.Counter)
+	}
+}
+
+func TestOOVModes(t *testing.T) {
+	u := ExtractUnigram([][]string{{"cat", "sat", "mat"}})
+	doc := []string{"cat", "zzz", "zzz", "sat", "mat"}
+	cat, sat, mat := int64(u.encoder["cat"]), int64(u.encoder["sat"]), int64(u.encoder["mat"])
+	win := MakeWindow(2, "")
+
+	// Purging makes cat and sat look adjacent.
+	c := ExtractCooc(u.EncodeDoc(doc), *win)
+	if c.Counter[CantorPairing(cat, sat)] != 1 {
+		t.Errorf("Purged OOV words should bring cat next to sat, got %v\n", c.Counter)
+	}
+
+	// Gaps keep them 3 words apart, out of the window.
+	u.SetOOVMode("gap")
+	c = ExtractCooc(u.EncodeDoc(doc), *win)
+	if len(c.Counter) != 2 || c.Counter[CantorPairing(sat, mat)] != 1 {
+		t.Errorf("Gaps should only leave sat and mat together, got %v\n", c.Counter)
+	}
+
+	// The OOV token is counted like any other word.
+	u.SetOOVMode("token")
+	oov := int64(u.Len())
+	c = ExtractCooc(u.EncodeDoc(doc), *win)
+	if c.Counter[CantorPairing(oov, cat)] != 1.5 || c.Counter[CantorPairing(oov, oov)] != 2 {
+		t.Errorf("Expected counts with the OOV token %d, got %v\n", oov, c.Counter)
+	}
+	if u.Decode(int(oov)) != OOV {
+		t.Errorf("The OOV token should decode to %s!\n", OOV)
+	}
+}
+
+func TestSubsample(t *testing.T) {
+	doc := make([]string, 0, 1000)
+	for i := 0; i < 990; i++ {
+		doc = append(doc, "the")
+	}
+	for i := 0; i < 10; i++ {
+		doc = append(doc, fmt.Sprintf("w%d", i))
+	}
+	u := ExtractUnigram([][]string{doc})
+
+	// "the" is kept with probability sqrt(0.01 / 0.99), about 0.1, and rare words always are.
+	u.SetSample(0.01, 7)
+	codes := u.EncodeDoc(doc)
+	if len(codes) < 10+60 || len(codes) > 10+140 {
+		t.Errorf("Expected about 109 words after subsampling, got %d\n", len(codes))
+	}
+	for i := 0; i < 10; i++ {
+		if codes[len(codes)-10+i] != u.encoder[fmt.Sprintf("w%d", i)] {
+			t.Errorf("Rare words should never be dropped, got %v\n", codes[len(codes)-10:])
+		}
+	}
+	if again := u.EncodeDoc(doc); len(again) != len(codes) {
+		t.Errorf("The same seed should sample the same way, got %d then %d words\n", len(codes), len(again))
+	}
+	// Copies of a sentence elsewhere in the corpus are sampled independently.
+	if fmt.Sprint(u.EncodeSentence(doc, 0, 1)) == fmt.Sprint(codes) || fmt.Sprint(u.EncodeSentence(doc, 1, 0)) == fmt.Sprint(codes) {
+		t.Error("Repeated sentences should not all be sampled the same way!")
+	}
+	u.SetSample(0, 7)
+	if codes := u.EncodeDoc(doc); len(codes) != 1000 {
+		t.Errorf("Nothing should be dropped without sampling, got %d words\n", len(codes))
+	}
+}
+
+func TestSampledWindow(t *testing.T) {
+	doc := make([]int, 30000)
+	for i := range doc {
+		doc[i] = i % 3
+	}
+	win := MakeWindow(4, "")
+	expected := ExtractCooc(doc, *win)
+
+	// On average, sampled window sizes give the expected weights.
+	win.SetSampled(3)
+	sampled := ExtractCooc(doc, *win)
+	for key, count := range expected.Counter {
+		if math.Abs(float64(sampled.Counter[key]-count)) > 0.05*float64(count) {
+			t.Errorf("Sampled count %f is too far from expected count %f\n", sampled.Counter[key], count)
+		}
+		if sampled.Counter[key] != float32(int(sampled.Counter[key])) {
+			t.Errorf("Sampled contexts should all have weight 1, got a total of %f\n", sampled.Counter[key])
+		}
+	}
+	if again := ExtractCooc(doc, *win); again.Counter[CantorPairing(0, 1)] != sampled.Counter[CantorPairing(0, 1)] {
+		t.Error("The same seed should draw the same window sizes!")
+	}
+	elsewhere := ConstructCooc()
+	elsewhere.AddSentence(doc, 1, 0, *win)
+	if elsewhere.Counter[CantorPairing(0, 1)] == sampled.Counter[CantorPairing(0, 1)] {
+		t.Error("Repeated sentences should draw window sizes of their own!")
+	}
+
+	// The linear scheme is the dynamic window, so it can be sampled too.
+	linear := MakeSchemeWindow(4, "linear")
+	linear.SetSampled(3)
+	if again := ExtractCooc(doc, *linear); again.Counter[CantorPairing(0, 1)] != sampled.Counter[CantorPairing(0, 1)] {
+		t.Error("The linear scheme should sample just like -w!")
+	}
+}
+
+func TestPositionalCooc(t *testing.T) {
+	doc := []int{3, 1, 4, 1, 5, 9, 2, 6, 5, 3, 5}
+	win := MakeWindow(4, "")
+	plain := ExtractCooc(doc, *win)
+	win.SetPositional()
+	pos := ExtractCooc(doc, *win)
+	if count := pos.Counter[PositionalKey(CantorPairing(4, 3), -2)]; count != 1 {
+		t.Errorf("Expected 3 two words left of 4 once, got %f\n", count)
+	}
+
+	// Collapsing with the same window gives the plain counts back.
+	if pos.Reach != [2]int{4, 4} {
+		t.Errorf("Expected a reach of 4 on each side, got %v\n", pos.Reach)
+	}
+	collapsed := Collapse(pos, MakeWindow(4, ""))
+	if len(collapsed.Counter) != len(plain.Counter) {
+		t.Errorf("Expected %d pairs after collapsing, got %d\n", len(plain.Counter), len(collapsed.Counter))
+	}
+	for key, count := range plain.Counter {
+		if math.Abs(float64(collapsed.Counter[key]-count)) > 1e-5 {
+			t.Errorf("Collapsed count %f does not match the extracted one, %f\n", collapsed.Counter[key], count)
+		}
+	}
+
+	// The mode goes through serializing, and positional counts do not mix with plain ones.
+	path := filepath.Join(t.TempDir(), "pos.cooc")
+	l := ConstructLogger("silent")
+	SerializeCooc(pos, 0, path, l)
+	loaded := ConstructCooc()
+	LoadCooc(loaded, path, l)
+	if loaded.Mode != "positional" || len(loaded.Counter) != len(pos.Counter) || loaded.Reach != pos.Reach {
+		t.Errorf("Expected %d positional counts, got %d %q ones\n", len(pos.Counter), len(loaded.Counter), loaded.Mode)
+	}
+	// A window reaching further than the extraction cannot be collapsed with.
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Should not collapse with weights beyond the reach of the coocs!")
+			}
+		}()
+		Collapse(loaded, MakeWindow(-1, "../data/test_data/sample_w10.w"))
+	}()
+	defer func() {
+		if recover() == nil {
+			t.Error("Should not merge positional coocs into plain ones!")
+		}
+	}()
+	plain.Merge(loaded)
+}
+
+func TestDirectionalCooc(t *testing.T) {
+	doc := []int{3, 1, 4, 1, 5, 9, 2, 6}
+	win := MakeWindow(-1, "../data/test_data/sample_asymmetricR.w")
+	plain := ExtractCooc(doc, *win)
+	win = MakeWindow(5, "")
+	both := ExtractCooc(doc, *win)
+	win.SetDirectional()
+	left, right := SplitDirections(ExtractCooc(doc, *win))
+	if left.Mode != "left" || right.Mode != "right" {
+		t.Errorf("Expected left and right modes, got %q and %q\n", left.Mode, right.Mode)
+	}
+
+	// Each side adds up to the symmetric counts.
+	for key, count := range both.Counter {
+		if math.Abs(float64(left.Counter[key]+right.Counter[key]-count)) > 1e-6 {
+			t.Errorf("Sides add up to %f instead of %f\n", left.Counter[key]+right.Counter[key], count)
+		}
+	}
+	if left.Counter[CantorPairing(4, 3)] == 0 || right.Counter[CantorPairing(4, 3)] != 0 {
+		t.Error("3 is only ever on the left of 4!")
+	}
+	if len(right.Counter) != len(plain.Counter) {
+		t.Errorf("Right contexts should be those of a right window, got %d vs %d\n", len(right.Counter), len(plain.Counter))
+	}
+}
+
+func TestStructuredCooc(t *testing.T) {
+	u := ExtractUnigram([][]string{{"the", "cat", "sat"}})
+	win := MakeWindow(2, "")
+	win.SetStructured()
+	c := ExtractCooc(u.EncodeDoc([]string{"the", "cat", "sat"}), *win)
+	if len(c.Counter) != 6 {
+		t.Errorf("Expected 6 structured pairs, got %d\n", len(c.Counter))
+	}
+	strs := make(map[string]float32)
+	for key, count := range c.Counter {
+		strs[c.keyString(key, u)] = count
+	}
+	if strs["sat cat@-1"] != 1 || strs["the sat@+2"] != 0.5 || strs["sat the@-2"] != 0.5 {
+		t.Errorf("Expected contexts like cat@-1 weighted by their offset, got %v\n", strs)
+	}
+
+	// Huge pairings are still inverted exactly.
+	context := StructuredContext(9999999, -127)
+	if k1, k2 := InverseCantor(CantorPairing(12345678, context)); k1 != 12345678 || int64(k2) != context {
+		t.Errorf("Bad inverse of a huge pairing, got %d and %d\n", k1, k2)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Corpus - the set of shards that documents are streamed from.
+// A shard is either a file (or stdin, as "-") of delimited documents, a tar archive,
+// or a directory tree; every member file of the latter two is a single document, or a
+// file of delimited records in the "jsonl" format.
+type Corpus struct {
+	paths   []string
+	shard   int // only the shard-th of nShards byte ranges (or members) of each shard is read.
+	nShards int
+	format  string   // "text" for raw documents, or "jsonl" for one JSON record per document.
+	field   []string // path to the text inside a JSON record.
+	delim   *Delimiter
+	docBase int64    // ID of the first document, see DocID.
+	label   []string // where the label of a document is, see SetLabel; nil for no labels.
+}
+
+// A document as it is streamed, with its label if the corpus has any.
+type document struct {
+	text  string
+	label string
+}
+
+// ConstructCorpus - constructor, paths are read in the order given.
+func ConstructCorpus(paths []string) *Corpus {
+	return &Corpus{paths: paths, shard: 0, nShards: 1, format: "text", delim: MakeDelimiter("newline")}
+}
+
+// SetDelimiter - sets where documents end in files, see MakeDelimiter.
+// Member files of tar archives and directories are one document each, unless they are JSONL.
+func (c *Corpus) SetDelimiter(d *Delimiter) {
+	c.delim = d
+}
+
+// SetFormat - sets how documents are read, either as raw "text" or as "jsonl" records,
+// in which case the document is the string at the dot-separated field path (e.g., "meta.body").
+func (c *Corpus) SetFormat(format, field string) {
+	switch format {
+	case "text":
+		c.field = nil
+	case "jsonl":
+		if field == "" {
+			panic("Need a field to read the text from in JSONL records!")
+		}
+		c.field = strings.Split(field, ".")
+	default:
+		panic(fmt.Sprintf("Input format %s is invalid!", format))
+	}
+	c.format = format
+}
+
+// SetLabel - makes the corpus read a label for each document, for word-label coocs: in
+// "jsonl" format, spec is the dot-separated path to the label in each record (which may be a
+// string or a number), and in "text" format it must be "lead", for the leading field of each
+// document, up to the first whitespace, which is then cut from the text. Unlabeled documents
+// are skipped. Set the format first.
+func (c *Corpus) SetLabel(spec string) {
+	switch {
+	case c.format == "jsonl":
+		c.label = strings.Split(spec, ".")
+	case spec == "lead":
+		c.label = []string{spec}
+	default:
+		panic(fmt.Sprintf("Label %s is invalid for text documents, need lead!", spec))
+	}
+}
+
+// SetShard - restricts the corpus to the k-th of n byte ranges of each of its files,
+// so that independent processes can split a huge file without preprocessing it.
+// Tar archives and directories are split by taking every n-th member file instead.
+func (c *Corpus) SetShard(k, n int) {
+	if n < 1 || k < 0 || k >= n {
+		panic(fmt.Sprintf("Invalid shard %d/%d, need 0 <= k < N!", k, n))
+	}
+	c.shard, c.nShards = k, n
+}
+
+// SetDocBase - sets the ID of the first document, for corpora split between processes
+// some other way than with SetShard, so that their document IDs do not overlap.
+func (c *Corpus) SetDocBase(base int64) {
+	c.docBase = base
+}
+
+// DocID - a globally unique ID for the idx-th document streamed from the corpus: the
+// documents of shard k of N get the IDs base+k, base+k+N, base+k+2N, and so on.
+func (c *Corpus) DocID(idx int) int64 {
+	return c.docBase + int64(idx)*int64(c.nShards) + int64(c.shard)
+}
+
+// Stream - streams every shard of the corpus through one channel.
+// The files may be plain text or compressed with gzip, zstd, bzip2 or xz.
+// The channel is closed once all of the shards have been read.
+func (c *Corpus) Stream(logger *Logger) <-chan string {
+	texts := make(chan string, BUFFERSIZE)
+	go func() {
+		defer close(texts)
+		for doc := range c.streamLabeled(logger) {
+			texts <- doc.text
+		}
+	}()
+	return texts
+}
+
+// Streams every document of the corpus with its label, see Stream.
+func (c *Corpus) streamLabeled(logger *Logger) <-chan document {
+	docs := make(chan document, BUFFERSIZE)
+	go func() {
+		defer close(docs)
+		counts := streamCounts{}
+		for i, path := range c.paths {
+			if c.nShards > 1 {
+				logger.Log(fmt.Sprintf("Streaming shard %d/%d of file %s (%d/%d)...",
+					c.shard, c.nShards, path, i+1, len(c.paths)))
+			} else {
+				logger.Log(fmt.Sprintf("Streaming file %s (%d/%d)...", path, i+1, len(c.paths)))
+			}
+			c.streamPath(path, docs, &counts, logger)
+		}
+		logger.Log(fmt.Sprintf("\tfinished reading %d docs", counts.docs))
+		if counts.malformed > 0 {
+			logger.Log(fmt.Sprintf("\tskipped %d malformed records", counts.malformed))
+		}
+		if counts.unlabeled > 0 {
+			logger.Log(fmt.Sprintf("\tskipped %d unlabeled docs", counts.unlabeled))
+		}
+	}()
+	return docs
+}
+
+// Running counts while streaming a corpus.
+type streamCounts struct {
+	docs      int
+	malformed int
+	unlabeled int
+	members   int // member files of tars and directories seen, whether ours or not.
+}
+
+// Sends a single document along, logging progress; a leading label is cut from the
+// text first, and unlabeled documents are skipped.
+func (c *Corpus) send(docs chan<- document, doc document, counts *streamCounts, logger *Logger) {
+	if c.format == "text" && c.label != nil {
+		text := strings.TrimLeftFunc(doc.text, unicode.IsSpace)
+		end := strings.IndexFunc(text, unicode.IsSpace)
+		if end < 0 {
+			end = len(text)
+		}
+		doc.label, doc.text = text[:end], text[end:]
+	}
+	if c.label != nil && doc.label == "" {
+		counts.unlabeled++
+		return
+	}
+	docs <- doc
+	counts.docs++
+	if counts.docs%LOGEVERY == 0 {
+		logger.Log(fmt.Sprintf("\t%d docs read", counts.docs))
+	}
+}
+
+// Whether the next member file belongs to our shard; members are dealt round-robin.
+func (c *Corpus) ownsMember(counts *streamCounts) bool {
+	counts.members++
+	return (counts.members-1)%c.nShards == c.shard
+}
+
+// Pulls the value at a field path out of a decoded JSON record.
+func jsonValue(v interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// Pulls the string at a field path out of a decoded JSON record.
+func jsonString(v interface{}, path []string) (string, bool) {
+	v, ok := jsonValue(v, path)
+	if !ok {
+		return "", false
+	}
+	text, ok := v.(string)
+	return text, ok
+}
+
+// Pulls the label at a field path out of a decoded JSON record, a string or a number;
+// whitespace in it is replaced by underscores, so that it can be written as one field.
+func jsonLabel(v interface{}, path []string) string {
+	v, _ = jsonValue(v, path)
+	switch label := v.(type) {
+	case string:
+		return strings.Join(strings.Fields(label), "_")
+	case float64:
+		return strconv.FormatFloat(label, 'f', -1, 64)
+	}
+	return ""
+}
+
+// Sends the documents of a single shard into docs, whatever kind of shard it is.
+func (c *Corpus) streamPath(path string, docs chan<- document, counts *streamCounts, logger *Logger) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		c.streamDir(path, docs, counts, logger)
+		return
+	}
+	var fz io.ReadCloser
+	var err error
+	if path == STDIN {
+		fz, err = Decompress(os.Stdin)
+	} else {
+		fz, err = OpenCorpusFile(path)
+	}
+	if err != nil {
+		panic(err)
+	}
+	defer fz.Close()
+
+	br := bufio.NewReader(fz)
+	if header, _ := br.Peek(TARHEADERLEN); IsTar(header) {
+		c.streamTar(tar.NewReader(br), docs, counts, logger)
+		return
+	}
+	if c.nShards > 1 {
+		if path == STDIN {
+			panic("Cannot take byte ranges of stdin!")
+		}
+		// Byte ranges are taken from the raw file, so start over from its beginning.
+		shard, err := OpenShard(path, c.shard, c.nShards, c.delim.split)
+		if err != nil {
+			panic(err)
+		}
+		defer shard.Close()
+		c.streamDelimited(shard, docs, counts, logger)
+		return
+	}
+	c.streamDelimited(br, docs, counts, logger)
+}
+
+// Sends every regular file in a directory tree as one document, in lexical order.
+func (c *Corpus) streamDir(root string, docs chan<- document, counts *streamCounts, logger *Logger) {
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || !c.ownsMember(counts) {
+			return nil
+		}
+		fz, err := OpenCorpusFile(path)
+		if err != nil {
+			return err
+		}
+		defer fz.Close()
+		return c.sendMember(fz, docs, counts, logger)
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Sends every regular member file of a tar archive as one document.
+func (c *Corpus) streamTar(tr *tar.Reader, docs chan<- document, counts *streamCounts, logger *Logger) {
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			panic(err)
+		}
+		if header.Typeflag != tar.TypeReg || !c.ownsMember(counts) {
+			continue
+		}
+		member, err := Decompress(tr)
+		if err != nil {
+			panic(err)
+		}
+		err = c.sendMember(member, docs, counts, logger)
+		member.Close()
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Sends a member file of a tar archive or directory, as a single document of text, or as
+// the delimited records of a JSONL file.
+func (c *Corpus) sendMember(r io.Reader, docs chan<- document, counts *streamCounts, logger *Logger) error {
+	if c.format == "jsonl" {
+		c.streamDelimited(r, docs, counts, logger)
+		return nil
+	}
+	doc, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	c.send(docs, document{text: string(doc)}, counts, logger)
+	return nil
+}
+
+// Sends every delimited document of a stream.
+func (c *Corpus) streamDelimited(r io.Reader, docs chan<- document, counts *streamCounts, logger *Logger) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MAXDOCLEN)
+	scanner.Split(c.delim.split)
+	for scanner.Scan() {
+		doc := document{text: scanner.Text()}
+		if c.format == "jsonl" {
+			if strings.TrimSpace(doc.text) == "" {
+				continue
+			}
+			var record interface{}
+			if err := json.Unmarshal([]byte(doc.text), &record); err != nil {
+				counts.malformed++
+				continue
+			}
+			text, ok := jsonString(record, c.field)
+			if !ok {
+				counts.malformed++
+				continue
+			}
+			doc.text = text
+			if c.label != nil {
+				doc.label = jsonLabel(record, c.label)
+			}
+		}
+		c.send(docs, doc, counts, logger)
+	}
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Helper to write a small corpus file and get its path.
+func writeCorpusFile(t *testing.T, name, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Helper to collect every document streamed from a corpus.
+func collectDocs(c *Corpus) []string {
+	var docs []string
+	for doc := range c.Stream(ConstructLogger("silent")) {
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func TestJSONLCorpus(t *testing.T) {
+	path := writeCorpusFile(t, "dump.jsonl", `{"id": 1, "meta": {"body": "the cat sat"}}
+{"id": 2, "meta": {"body": "on the mat"}}
+{"id": 3, "meta": {"title": "no body here"}}
+{"id": 4, "meta": {"body": 12}}
+not json at all
+
+{"id": 5, "meta": {"body": "the end"}}
+`)
+	c := ConstructCorpus([]string{path})
+	c.SetFormat("jsonl", "meta.body")
+	docs := collectDocs(c)
+	expected := []string{"the cat sat", "on the mat", "the end"}
+	if len(docs) != len(expected) {
+		t.Fatalf("Expected %d docs but got %d: %q\n", len(expected), len(docs), docs)
+	}
+	for i := range docs {
+		if docs[i] != expected[i] {
+			t.Errorf("Expected doc %q but got %q\n", expected[i], docs[i])
+		}
+	}
+}
+
+func TestTarAndDirCorpus(t *testing.T) {
+	members := map[string]string{
+		"a/one.txt": "the cat sat\non the mat",
+		"a/two.txt": "the dog ran",
+		"b/six.txt": "far away",
+	}
+
+	// Tarball, gzipped as they usually ship.
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, name := range []string{"a/one.txt", "a/two.txt", "b/six.txt"} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(members[name]))})
+		tw.Write([]byte(members[name]))
+	}
+	tw.Close()
+	gw.Close()
+	tarPath := writeCorpusFile(t, "bundle.tar.gz", buf.String())
+
+	// Same files as a directory tree.
+	root := t.TempDir()
+	for name, contents := range members {
+		os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755)
+		ioutil.WriteFile(filepath.Join(root, name), []byte(contents), 0644)
+	}
+
+	for _, path := range []string{tarPath, root} {
+		docs := collectDocs(ConstructCorpus([]string{path}))
+		if len(docs) != 3 || docs[0] != members["a/one.txt"] || docs[2] != members["b/six.txt"] {
+			t.Errorf("Bad documents from %s: %q\n", path, docs)
+		}
+
+		// Sharding deals the members out round-robin.
+		seen := 0
+		for k := 0; k < 2; k++ {
+			c := ConstructCorpus([]string{path})
+			c.SetShard(k, 2)
+			seen += len(collectDocs(c))
+		}
+		if seen != 3 {
+			t.Errorf("Shards of %s should cover 3 members but got %d!\n", path, seen)
+		}
+	}
+}
+
+func TestTarAndDirJSONLCorpus(t *testing.T) {
+	members := map[string]string{
+		"a.jsonl": `{"text":"alpha beta"}` + "\n" + `{"text":"gamma"}` + "\n",
+		"b.jsonl": `{"body":"none"}` + "\n" + `{"text":"delta"}` + "\n",
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	root := t.TempDir()
+	for _, name := range []string{"a.jsonl", "b.jsonl"} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(members[name]))})
+		tw.Write([]byte(members[name]))
+		ioutil.WriteFile(filepath.Join(root, name), []byte(members[name]), 0644)
+	}
+	tw.Close()
+	tarPath := writeCorpusFile(t, "records.tar", buf.String())
+
+	// Member files of JSONL records give a document per record, not per file.
+	for _, path := range []string{tarPath, root} {
+		c := ConstructCorpus([]string{path})
+		c.SetFormat("jsonl", "text")
+		docs := collectDocs(c)
+		if len(docs) != 3 || docs[0] != "alpha beta" || docs[2] != "delta" {
+			t.Errorf("Bad records from %s: %q\n", path, docs)
+		}
+	}
+}
+
+func TestStdinCorpus(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	// Pipelines may hand us compressed streams too.
+	go func() {
+		gw := gzip.NewWriter(w)
+		gw.Write([]byte("the cat sat\non the mat\n"))
+		gw.Close()
+		w.Close()
+	}()
+	docs := collectDocs(ConstructCorpus(loadExperimentPaths("-")))
+	if len(docs) != 2 || docs[1] != "on the mat" {
+		t.Errorf("Bad documents from stdin: %q\n", docs)
+	}
+}
+
+func TestDelimiters(t *testing.T) {
+	text := "The cat sat.\nIt was happy.\n\n  \nThe dog ran.\n\nThe end.\n"
+	path := writeCorpusFile(t, "sents.txt", text)
+	expected := map[string][]string{
+		"newline":       {"The cat sat.", "It was happy.", "", "  ", "The dog ran.", "", "The end."},
+		"blank":         {"The cat sat.\nIt was happy.", "The dog ran.", "The end.\n"},
+		"regex:[.]\\s*": {"The cat sat", "It was happy", "The dog ran", "The end"},
+		"none":          {text},
+	}
+	for spec, docs := range expected {
+		c := ConstructCorpus([]string{path})
+		c.SetDelimiter(MakeDelimiter(spec))
+		got := collectDocs(c)
+		if len(got) != len(docs) {
+			t.Errorf("Delimiter %s: expected %q but got %q\n", spec, docs, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != docs[i] {
+				t.Errorf("Delimiter %s: expected doc %q but got %q\n", spec, docs[i], got[i])
+			}
+		}
+
+		// Shards must agree with the delimiter on where documents end.
+		var sharded []string
+		for k := 0; k < 3; k++ {
+			c.SetShard(k, 3)
+			sharded = append(sharded, collectDocs(c)...)
+		}
+		if len(sharded) != len(docs) {
+			t.Errorf("Delimiter %s: shards expected %q but got %q\n", spec, docs, sharded)
+		}
+	}
+}
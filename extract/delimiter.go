@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// NOBOUNDARYLEN - with no document boundaries, the stream is still cut into
+// documents of about this many bytes (at whitespace) so that it can be parallelized.
+const NOBOUNDARYLEN = int(1 << 20)
+
+// Documents separated by one or more blank lines.
+const blankLinePattern = `\n[ \t\r]*\n\s*`
+
+// Delimiter - splits a stream of text into documents.
+type Delimiter struct {
+	name  string
+	split bufio.SplitFunc
+}
+
+// MakeDelimiter - creates a Delimiter from its specification; one of
+// "newline" (one document per line), "blank" (documents separated by blank lines),
+// "regex:PATTERN" (documents separated by matches of PATTERN), or
+// "none" (no boundaries, so windows flow across lines).
+func MakeDelimiter(spec string) *Delimiter {
+	switch {
+	case spec == "newline":
+		return &Delimiter{spec, bufio.ScanLines}
+	case spec == "blank":
+		return &Delimiter{spec, regexSplit(regexp.MustCompile(blankLinePattern))}
+	case strings.HasPrefix(spec, "regex:"):
+		re := regexp.MustCompile(strings.TrimPrefix(spec, "regex:"))
+		if re.MatchString("") {
+			panic(fmt.Sprintf("Delimiter %s matches the empty string!", spec))
+		}
+		return &Delimiter{spec, regexSplit(re)}
+	case spec == "none":
+		return &Delimiter{spec, noBoundarySplit}
+	}
+	panic(fmt.Sprintf("Delimiter %s is invalid!", spec))
+}
+
+// Makes a split function that cuts documents at each match of a regexp.
+func regexSplit(re *regexp.Regexp) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		// A match touching the end of the buffer may still grow, so wait for more.
+		if loc := re.FindIndex(data); loc != nil && (loc[1] < len(data) || atEOF) {
+			return loc[1], data[:loc[0]], nil
+		}
+		if atEOF {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// Split function that only cuts at the first whitespace after NOBOUNDARYLEN bytes.
+func noBoundarySplit(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if len(data) > NOBOUNDARYLEN {
+		if i := bytes.IndexAny(data[NOBOUNDARYLEN:], " \t\r\n"); i >= 0 {
+			end := NOBOUNDARYLEN + i
+			return end + 1, data[:end], nil
+		}
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
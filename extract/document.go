@@ -0,0 +1,105 @@
+package main
+
+import "fmt"
+
+/* Contexts made of whole documents rather than windows, for LSA-style analyses, or of
+their labels, for word-label matrices. */
+
+// MakeDocumentWindow - creates a Window whose context is the whole document: with mode
+// "doc", every word is counted with every other word of its document, with mode
+// "termdoc", every word is counted with the ID of its document, giving a term-document
+// matrix, and with mode "label", every word is counted with the label of its document,
+// see Corpus.SetLabel. Document IDs are unique across the shards of a corpus, see
+// Corpus.DocID, and labels get codes of their own, see Cooc.Labels.
+func MakeDocumentWindow(mode string) *Window {
+	if mode != "doc" && mode != "termdoc" && mode != "label" {
+		panic(fmt.Sprintf("Document context %s is invalid, need doc, termdoc or label!", mode))
+	}
+	return &Window{document: mode, unit: 1}
+}
+
+// AddDocument - adds the cooccurrence statistics of a document of encoded sentences, with
+// the given document ID and label; sentences only matter to sliding windows, see AddSentences.
+func (c *Cooc) AddDocument(sents [][]int, docID int64, label string, win Window) {
+	if win.document == "" {
+		c.AddSentences(sents, docID, win)
+		return
+	}
+	c.checkMode(win.CoocMode())
+	var doc []int
+	for _, sent := range sents {
+		doc = append(doc, sent...)
+	}
+	switch win.document {
+	case "termdoc":
+		c.addTermDoc(doc, docID)
+	case "label":
+		c.addLabeled(doc, label)
+	default:
+		c.addDocContext(doc)
+	}
+}
+
+// Counts each word of a document with its label.
+func (c *Cooc) addLabeled(encodedDoc []int, label string) {
+	labelCode := int64(c.labelCode(label))
+	for _, code := range encodedDoc {
+		if code >= 0 {
+			c.Counter[CantorPairing(int64(code), labelCode)]++
+		}
+	}
+}
+
+// Gets the code of a label, giving it the next one if it is new.
+func (c *Cooc) labelCode(label string) int {
+	if c.labelCodes == nil {
+		c.labelCodes = make(map[string]int)
+	}
+	code, ok := c.labelCodes[label]
+	if !ok {
+		code = len(c.Labels)
+		c.labelCodes[label] = code
+		c.Labels = append(c.Labels, label)
+	}
+	return code
+}
+
+// Maps the keys of word-label counts with another label vocabulary to our label codes.
+func (c *Cooc) labelRecoder(labels []string) func(int64) int64 {
+	codes := make([]int64, len(labels))
+	for i, label := range labels {
+		codes[i] = int64(c.labelCode(label))
+	}
+	return func(key int64) int64 {
+		word, labelCode := InverseCantor(key)
+		return CantorPairing(int64(word), codes[labelCode])
+	}
+}
+
+// Counts each word of a document with its document ID.
+func (c *Cooc) addTermDoc(encodedDoc []int, docID int64) {
+	for _, code := range encodedDoc {
+		if code >= 0 {
+			c.Counter[CantorPairing(int64(code), docID)]++
+		}
+	}
+}
+
+// Counts each word of a document with every other word of it, by their frequencies.
+func (c *Cooc) addDocContext(encodedDoc []int) {
+	freqs := make(map[int]float32)
+	for _, code := range encodedDoc {
+		if code >= 0 {
+			freqs[code]++
+		}
+	}
+	for term, tf := range freqs {
+		for context, cf := range freqs {
+			if term == context {
+				c.Counter[CantorPairing(int64(term), int64(context))] += tf * (tf - 1)
+			} else {
+				c.Counter[CantorPairing(int64(term), int64(context))] += tf * cf
+			}
+		}
+	}
+}
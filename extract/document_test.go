@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestDocumentContexts(t *testing.T) {
+	u := ExtractUnigram([][]string{{"a", "b", "c"}})
+	a, b := int64(u.encoder["a"]), int64(u.encoder["b"])
+	c := ConstructCooc()
+	c.AddDocument([][]int{u.EncodeDoc([]string{"a", "b", "a"}), u.EncodeDoc([]string{"c"})}, 0, "", *MakeDocumentWindow("doc"))
+	if c.Mode != "doc" || c.Counter[CantorPairing(a, b)] != 2 || c.Counter[CantorPairing(a, a)] != 2 {
+		t.Errorf("Expected a with b twice and with itself twice, got %v\n", c.Counter)
+	}
+
+	// Document IDs are unique across the shards of a corpus.
+	path := writeCorpusFile(t, "docs.txt", "a b\nb c\na a\nc\n")
+	l := ConstructLogger("silent")
+	parser := ConstructParser()
+	seen := make(map[int]bool)
+	twice := 0
+	for k := 0; k < 2; k++ {
+		corpus := ConstructCorpus([]string{path})
+		corpus.SetShard(k, 2)
+		corpus.SetDocBase(100)
+		termdoc := CoocExtraction(corpus, parser, u, MakeDocumentWindow("termdoc"), l)
+		for key, count := range termdoc.Counter {
+			code, docID := InverseCantor(key)
+			if docID < 100 || docID%2 != k {
+				t.Errorf("Document ID %d is not from shard %d/2\n", docID, k)
+			}
+			if code == int(a) && count == 2 {
+				twice++
+			}
+			seen[docID] = true
+		}
+	}
+	if len(seen) != 4 || twice != 1 {
+		t.Errorf("Expected 4 distinct document IDs and one with a twice, got %v and %d\n", seen, twice)
+	}
+}
+
+func TestLabelContexts(t *testing.T) {
+	u := ExtractUnigram([][]string{{"a", "b", "c"}})
+	l := ConstructLogger("silent")
+	parser := ConstructParser()
+	countsOf := func(c *Cooc) map[string]float32 {
+		strs := make(map[string]float32)
+		for key, count := range c.Counter {
+			strs[c.keyString(key, u)] = count
+		}
+		return strs
+	}
+
+	// Labels from a JSONL attribute, numbers included; unlabeled records are skipped.
+	path := writeCorpusFile(t, "docs.jsonl", `{"text": "a b a", "meta": {"year": 1999}}
+{"text": "b c", "meta": {"year": "the 2000s"}}
+{"text": "c c"}
+{"text": "a", "meta": {"year": 1999}}
+`)
+	corpus := ConstructCorpus([]string{path})
+	corpus.SetFormat("jsonl", "text")
+	corpus.SetLabel("meta.year")
+	jsonl := CoocExtraction(corpus, parser, u, MakeDocumentWindow("label"), l)
+	strs := countsOf(jsonl)
+	if len(strs) != 4 || strs["a 1999"] != 3 || strs["b the_2000s"] != 1 {
+		t.Errorf("Bad word-label counts, got %v\n", strs)
+	}
+
+	// Leading labels are cut from the text, and label codes are remapped when merging.
+	path = writeCorpusFile(t, "docs.txt", "the_2000s c c\n1999\tb\n")
+	corpus = ConstructCorpus([]string{path})
+	corpus.SetLabel("lead")
+	text := CoocExtraction(corpus, parser, u, MakeDocumentWindow("label"), l)
+	gobPath := writeCorpusFile(t, "labels.cooc", "")
+	SerializeCooc(text, 0, gobPath, l)
+	LoadCooc(jsonl, gobPath, l)
+	strs = countsOf(jsonl)
+	if len(jsonl.Labels) != 2 || strs["c the_2000s"] != 3 || strs["b 1999"] != 2 || strs["a 1999"] != 3 {
+		t.Errorf("Bad merged word-label counts, got %v\n", strs)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+/* Cache of an encoded corpus, so that it is only tokenized and encoded once.
+
+The file starts with encodedMagic and a header of uvarints and strings (each a uvarint
+length followed by its bytes): the checksum of the unigram that encoded the corpus, and the
+sentence splitting mode used. Then come the documents: for each one, its number of sentences,
+and for each sentence its number of tokens followed by the tokens as uvarints of code+1,
+where 0 marks an OOV word. The documents are followed by an index with the number of
+documents, the block size, and the byte offset of every ENCBLOCK-th document, and the file
+ends with the byte offset of that index as a fixed 8 bytes. */
+
+var encodedMagic = []byte("GOEXTRACT-ENC1\n")
+
+// ENCBLOCK - number of documents between two offsets in the index of an encoded corpus.
+const ENCBLOCK = 1024
+
+// OOVCODE - code for an out-of-vocabulary word when it is kept in an encoded document.
+const OOVCODE = -1
+
+// EncodedHeader - what an encoded corpus was encoded with.
+type EncodedHeader struct {
+	Checksum  string // checksum of the unigram file.
+	Sentences string // sentence splitting mode, "" if documents were not split.
+}
+
+// IsEncodedFile - whether the file at path is an encoded corpus.
+func IsEncodedFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, len(encodedMagic))
+	n, _ := io.ReadFull(f, magic)
+	return bytes.Equal(magic[:n], encodedMagic)
+}
+
+/* Writing */
+
+// EncodedWriter - writes encoded documents to disk, in order.
+type EncodedWriter struct {
+	file    *os.File
+	w       *bufio.Writer
+	offset  int64
+	nDocs   int
+	offsets []int64
+	buf     []byte
+}
+
+func (e *EncodedWriter) write(b []byte) {
+	if _, err := e.w.Write(b); err != nil {
+		panic(err)
+	}
+	e.offset += int64(len(b))
+}
+
+func (e *EncodedWriter) writeUvarint(x uint64) {
+	n := binary.PutUvarint(e.buf, x)
+	e.write(e.buf[:n])
+}
+
+func (e *EncodedWriter) writeString(s string) {
+	e.writeUvarint(uint64(len(s)))
+	e.write([]byte(s))
+}
+
+// ConstructEncodedWriter - creates the file and writes its header.
+func ConstructEncodedWriter(fullPath string, header EncodedHeader) *EncodedWriter {
+	f, err := os.Create(fullPath)
+	if err != nil {
+		panic(err)
+	}
+	e := EncodedWriter{file: f, w: bufio.NewWriter(f), buf: make([]byte, binary.MaxVarintLen64)}
+	e.write(encodedMagic)
+	e.writeString(header.Checksum)
+	e.writeString(header.Sentences)
+	return &e
+}
+
+// WriteDoc - writes the next document, as its encoded sentences with OOVCODE for OOV words.
+func (e *EncodedWriter) WriteDoc(sents [][]int) {
+	if e.nDocs%ENCBLOCK == 0 {
+		e.offsets = append(e.offsets, e.offset)
+	}
+	e.writeUvarint(uint64(len(sents)))
+	for _, sent := range sents {
+		e.writeUvarint(uint64(len(sent)))
+		for _, code := range sent {
+			e.writeUvarint(uint64(code + 1))
+		}
+	}
+	e.nDocs++
+}
+
+// Close - writes the index and closes the file.
+func (e *EncodedWriter) Close() {
+	indexStart := e.offset
+	e.writeUvarint(uint64(e.nDocs))
+	e.writeUvarint(ENCBLOCK)
+	for _, offset := range e.offsets {
+		e.writeUvarint(uint64(offset))
+	}
+	binary.LittleEndian.PutUint64(e.buf, uint64(indexStart))
+	e.write(e.buf[:8])
+	if err := e.w.Flush(); err != nil {
+		panic(err)
+	}
+	e.file.Close()
+}
+
+/* Reading */
+
+func readString(r *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return string(b), err
+}
+
+// ReadEncodedHeader - reads the header of an encoded corpus.
+func ReadEncodedHeader(r *bufio.Reader) (EncodedHeader, error) {
+	var h EncodedHeader
+	magic := make([]byte, len(encodedMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, encodedMagic) {
+		return h, fmt.Errorf("not an encoded corpus")
+	}
+	var err error
+	if h.Checksum, err = readString(r); err != nil {
+		return h, err
+	}
+	h.Sentences, err = readString(r)
+	return h, err
+}
+
+// Reads the index of block offsets at the end of an encoded corpus, and where it starts.
+func readEncodedIndex(f *os.File) ([]int64, int64, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	tail := make([]byte, 8)
+	if _, err := f.ReadAt(tail, stat.Size()-8); err != nil {
+		return nil, 0, err
+	}
+	indexStart := int64(binary.LittleEndian.Uint64(tail))
+	r := bufio.NewReader(io.NewSectionReader(f, indexStart, stat.Size()-8-indexStart))
+	nDocs, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	block, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	offsets := make([]int64, (nDocs+block-1)/block)
+	for i := range offsets {
+		offset, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		offsets[i] = int64(offset)
+	}
+	return offsets, indexStart, nil
+}
+
+// Reads the next document from a stream of encoded documents.
+func readEncodedDoc(r *bufio.Reader) ([][]int, error) {
+	nSents, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	sents := make([][]int, nSents)
+	for i := range sents {
+		nTokens, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		sents[i] = make([]int, nTokens)
+		for j := range sents[i] {
+			code, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			sents[i][j] = int(code) - 1
+		}
+	}
+	return sents, nil
+}
+
+// Reads the header of an encoded corpus file, checking that it was encoded by our unigram.
+func checkEncodedFile(path string, checksum, sentences string) EncodedHeader {
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	header, err := ReadEncodedHeader(bufio.NewReader(f))
+	if err != nil {
+		panic(fmt.Sprintf("Bad encoded corpus %s: %s", path, err))
+	}
+	if header.Checksum != checksum {
+		panic(fmt.Sprintf("Encoded corpus %s was encoded with a different unigram!", path))
+	}
+	if header.Sentences != sentences {
+		panic(fmt.Sprintf("Encoded corpus %s was split into sentences with mode %q, not %q!",
+			path, header.Sentences, sentences))
+	}
+	return header
+}
+
+// Sends the documents of one encoded corpus into docs, only the k-th of n block ranges.
+func streamEncodedFile(path string, k, n int, docs chan<- [][]int) {
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	offsets, indexStart, err := readEncodedIndex(f)
+	if err != nil {
+		panic(fmt.Sprintf("Bad index in encoded corpus %s: %s", path, err))
+	}
+	start, end := len(offsets)*k/n, len(offsets)*(k+1)/n
+	if start == end {
+		return
+	}
+	endOffset := indexStart
+	if end < len(offsets) {
+		endOffset = offsets[end]
+	}
+	r := bufio.NewReader(io.NewSectionReader(f, offsets[start], endOffset-offsets[start]))
+	for {
+		doc, err := readEncodedDoc(r)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			panic(fmt.Sprintf("Corrupted encoded corpus %s: %s", path, err))
+		}
+		docs <- doc
+	}
+}
+
+// StreamEncoded - streams the documents of a corpus of encoded files, checking that
+// they were encoded by the unigram with the given checksum and split into sentences with
+// the given mode ("" if they are not); when sharding, each file is split into ranges of
+// ENCBLOCK documents.
+func (c *Corpus) StreamEncoded(checksum, sentences string, logger *Logger) <-chan [][]int {
+	for _, path := range c.paths {
+		checkEncodedFile(path, checksum, sentences)
+	}
+	docs := make(chan [][]int, BUFFERSIZE)
+	go func() {
+		defer close(docs)
+		for i, path := range c.paths {
+			logger.Log(fmt.Sprintf("Streaming encoded file %s (%d/%d)...", path, i+1, len(c.paths)))
+			streamEncodedFile(path, c.shard, c.nShards, docs)
+		}
+	}()
+	return docs
+}
+
+// IsEncoded - whether the corpus is made of encoded files; it cannot be a mix.
+func (c *Corpus) IsEncoded() bool {
+	encoded := 0
+	for _, path := range c.paths {
+		if path != STDIN && IsEncodedFile(path) {
+			encoded++
+		}
+	}
+	if encoded > 0 && encoded < len(c.paths) {
+		panic("Cannot mix encoded corpora with text ones!")
+	}
+	return encoded > 0
+}
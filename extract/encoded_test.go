@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodedCorpus(t *testing.T) {
+	l := ConstructLogger("silent")
+	dir := t.TempDir()
+	sample := []string{"../data/test_data/sample.txt.gz"}
+	parser := ConstructParser()
+
+	// Encoding needs a unigram loaded from disk, for its checksum.
+	documents := LoadSampleWords()
+	SerializeUnigram(FilterUnigram(ExtractUnigram(documents), 100), filepath.Join(dir, "small.unigram"))
+	u := LoadUnigram(filepath.Join(dir, "small.unigram"))
+
+	encPath := filepath.Join(dir, "sample.enc")
+	EncodeExtraction(ConstructCorpus(sample), parser, u, encPath, l)
+	if !IsEncodedFile(encPath) || IsEncodedFile(sample[0]) {
+		t.Fatal("Encoded files are not recognized!")
+	}
+
+	win := MakeWindow(3, "")
+	expected := CoocExtraction(ConstructCorpus(sample), parser, u, win, l)
+	c := CoocExtraction(ConstructCorpus([]string{encPath}), parser, u, win, l)
+	if len(c.Counter) != len(expected.Counter) {
+		t.Errorf("Got %d pairs from the encoded corpus but expected %d!\n", len(c.Counter), len(expected.Counter))
+	}
+	for cantor, count := range expected.Counter {
+		if math.Abs(float64(c.Counter[cantor]-count)) > 1e-3 {
+			t.Errorf("Different count for cantor %d: %f vs %f\n", cantor, c.Counter[cantor], count)
+		}
+	}
+
+	// Reading it as split into sentences must fail, since it was not.
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Should not read an encoded corpus with a different sentence mode!")
+			}
+		}()
+		ConstructCorpus([]string{encPath}).StreamEncoded(u.checksum, "rules", l)
+	}()
+
+	// Reading it with another unigram must fail.
+	SerializeUnigram(FilterUnigram(ExtractUnigram(documents), 10), filepath.Join(dir, "other.unigram"))
+	other := LoadUnigram(filepath.Join(dir, "other.unigram"))
+	defer func() {
+		if recover() == nil {
+			t.Error("Should not read an encoded corpus with a different unigram!")
+		}
+	}()
+	ConstructCorpus([]string{encPath}).StreamEncoded(other.checksum, "", l)
+}
@@ -2,86 +2,139 @@ package main
 
 import (
 	"fmt"
-	"strings"
-	"time"
+	"sync"
 )
 
-// ReadParseGz - reads a gzip and then parses it into documents.
-func ReadParseGz(filename string, replaceDigits bool, logger *Logger) [][]string {
-	logger.Log(fmt.Sprintf("Reading GZ file %s...", filename))
-	byteArr, _ := ReadGzFile(filename)
-
-	logger.Log("\tconverting to strings...")
-	fullStr := string(byteArr)
-	docs := strings.Split(fullStr, "\n")
+// ReadParseGz - reads a (possibly compressed) file and then parses it into documents.
+// This holds the whole corpus in memory, so it is only meant for small files.
+func ReadParseGz(filename string, parser *Parser, logger *Logger) [][]string {
+	var docs []string
+	for doc := range ConstructCorpus([]string{filename}).Stream(logger) {
+		docs = append(docs, doc)
+	}
 
 	// Using a channel in Parse to make this very fast.
 	logger.Log(fmt.Sprintf("\tparsing %d initial documents...", len(docs)))
-	return Parse(docs, replaceDigits)
+	return Parse(docs, parser)
 }
 
 /* Unigram Extraction */
 
 // UnigramExtraction - to be used when using large amounts of data.
-func UnigramExtraction(filename string, replaceDigits bool, logger *Logger) *Unigram {
+// Each worker counts into its own Unigram as documents arrive, then they are merged.
+func UnigramExtraction(corpus *Corpus, parser *Parser, logger *Logger) *Unigram {
+	docs := corpus.Stream(logger)
+	results := make(chan *Unigram, WORKERS)
+	for w := 0; w < WORKERS; w++ {
+		go func() {
+			local := ConstructUnigram()
+			for doc := range docs {
+				for _, sent := range parser.ParseSentences(doc) {
+					for _, word := range sent {
+						local.addStr(word, 1)
+					}
+				}
+			}
+			results <- local
+		}()
+	}
+
 	u := ConstructUnigram()
-	documents := ReadParseGz(filename, replaceDigits, logger)
-	logger.Log("\tdetermining the encoding and counting...")
-	extractWithUnigram(documents, u)
+	for w := 0; w < WORKERS; w++ {
+		u.Merge(<-results)
+	}
+	logger.Log("\tdetermined the encoding and counts")
 	u.FillIdx()
+	u.config = parser.Config()
 	return u
 }
 
+/* Phrase Extraction */
+
+// PhraseExtraction - learns the phrases of a corpus over a number of iterations, each one
+// streaming the corpus again with the phrases learned so far joined into single tokens.
+// A bigram is a phrase if its score is above threshold, see phraseCounts.score.
+// Phrases never cross the end of a sentence.
+func PhraseExtraction(corpus *Corpus, parser *Parser, iterations int, delta, threshold float64, logger *Logger) *Phrases {
+	for _, path := range corpus.paths {
+		if path == STDIN && iterations > 1 {
+			panic("Cannot read stdin again for more than one phrase iteration!")
+		}
+	}
+	phrases := ConstructPhrases()
+	for it := 0; it < iterations; it++ {
+		logger.Log(fmt.Sprintf("Learning phrases, iteration %d/%d...", it+1, iterations))
+		parser.SetPhrases(phrases)
+		docs := corpus.Stream(logger)
+		results := make(chan *phraseCounts, WORKERS)
+		for w := 0; w < WORKERS; w++ {
+			go func() {
+				local := constructPhraseCounts()
+				for doc := range docs {
+					for _, sent := range parser.ParseSentences(doc) {
+						local.add(sent)
+					}
+				}
+				results <- local
+			}()
+		}
+
+		counts := constructPhraseCounts()
+		for w := 0; w < WORKERS; w++ {
+			counts.merge(<-results)
+		}
+		found := counts.score(delta, threshold)
+		logger.Log(fmt.Sprintf("\tfound %d phrases among %d bigrams", len(found), len(counts.bigrams)))
+		phrases.iters = append(phrases.iters, found)
+	}
+	return phrases
+}
+
 /* Cooc Extraction */
 
 // CoocMerger - manages merging for Coocs with concurrency in mind.
 type CoocMerger struct {
-	state *Cooc
-	nDocs int
-	input chan *Cooc
-	done  chan bool
+	state    *Cooc
+	nWorkers int
+	input    chan *Cooc
+	done     chan bool
 }
 
 func (m *CoocMerger) listen() {
-	for i := 0; i < m.nDocs; i++ {
+	for i := 0; i < m.nWorkers; i++ {
 		received := <-m.input
 		m.state.Merge(received)
 	}
 	m.done <- true
 }
 
-// CoocExtraction - performs the full extraction pipeline.
-func CoocExtraction(filename string, u *Unigram, window *Window, replaceDigits bool, logger *Logger) *Cooc {
-	documents := ReadParseGz(filename, replaceDigits, logger)
-
-	logger.Log("Encoding documents...")
-	encodedDocs := UnigramEncode(u, documents)
-
-	logger.Log(fmt.Sprintf("Extracting cooccurences from %d docs...", len(encodedDocs)))
+// Counts cooccurrences with the workers; each one calls next to get its next document,
+// as encoded sentences numbered in the order of the corpus, until there are none left.
+func countCoocs(next func() (encodedJob, bool), corpus *Corpus, window *Window, logger *Logger) *Cooc {
+	logger.Log(fmt.Sprintf("Extracting cooccurences with %d workers...", WORKERS))
+	newCooc := func() *Cooc {
+		c := ConstructCooc()
+		c.Mode = window.CoocMode()
+		return c
+	}
 	merger := CoocMerger{
-		state: ConstructCooc(),
-		nDocs: len(encodedDocs),
-		input: make(chan *Cooc, BUFFERSIZE),
-		done:  make(chan bool)}
+		state:    newCooc(),
+		nWorkers: WORKERS,
+		input:    make(chan *Cooc, WORKERS),
+		done:     make(chan bool)}
 
 	// listener
 	go merger.listen()
 
-	// speaker
-	for i, doc := range encodedDocs {
-		go func(document []int) {
-			merger.input <- ExtractCooc(document, *window)
-		}(doc)
-		if (i+1)%BUFFERSIZE == 0 { // Give some slack to let things catch up.
-			for {
-				if len(merger.input) == 0 {
-					break
-				} else {
-					time.Sleep(250 * time.Millisecond)
-				}
+	// workers
+	for w := 0; w < WORKERS; w++ {
+		go func() {
+			local := newCooc()
+			for job, ok := next(); ok; job, ok = next() {
+				local.AddDocument(job.sents, corpus.DocID(job.idx), job.label, *window)
 			}
-			logger.Log(fmt.Sprintf("\t%d docs launched and merged", i+1))
-		}
+			merger.input <- local
+		}()
 	}
 	<-merger.done
 
@@ -89,3 +142,142 @@ func CoocExtraction(filename string, u *Unigram, window *Window, replaceDigits b
 	logger.Log("\tfinished Cooc extraction!")
 	return merger.state
 }
+
+// CoocExtraction - performs the full extraction pipeline.
+// Documents are parsed, encoded and counted by the workers as they are streamed in,
+// so memory depends on the number of workers rather than on the size of the corpus.
+// All of the shards in the corpus go through the same workers and into the same Cooc.
+// If the parser splits sentences, the window only crosses them with its cross-sentence weight.
+// A corpus of encoded files skips straight to counting.
+func CoocExtraction(corpus *Corpus, parser *Parser, u *Unigram, window *Window, logger *Logger) *Cooc {
+	if corpus.IsEncoded() {
+		if window.document == "label" {
+			panic("Encoded corpora do not keep the labels of documents!")
+		}
+		docs := numberEncoded(corpus.StreamEncoded(u.checksum, parser.SentenceMode(), logger))
+		return countCoocs(func() (encodedJob, bool) {
+			job, ok := <-docs
+			for i := range job.sents {
+				job.sents[i] = u.FilterEncoded(job.sents[i], corpus.DocID(job.idx), i)
+			}
+			return job, ok
+		}, corpus, window, logger)
+	}
+
+	u.CheckParser(parser)
+	docs := numberTexts(corpus.streamLabeled(logger))
+	return countCoocs(func() (encodedJob, bool) {
+		job, ok := <-docs
+		if !ok {
+			return job, false
+		}
+		sents := parser.ParseSentences(job.text)
+		job.text = ""
+		job.sents = make([][]int, len(sents))
+		for i, sent := range sents {
+			job.sents[i] = u.EncodeSentence(sent, corpus.DocID(job.idx), i)
+		}
+		return job, true
+	}, corpus, window, logger)
+}
+
+/* Corpus Encoding */
+
+// A document and its place in the corpus, before and after encoding.
+type encodedJob struct {
+	idx   int
+	text  string
+	label string
+	sents [][]int
+}
+
+// Numbers the documents of a stream in the order they are read.
+func numberTexts(docs <-chan document) <-chan encodedJob {
+	jobs := make(chan encodedJob, BUFFERSIZE)
+	go func() {
+		defer close(jobs)
+		i := 0
+		for doc := range docs {
+			jobs <- encodedJob{idx: i, text: doc.text, label: doc.label}
+			i++
+		}
+	}()
+	return jobs
+}
+
+// Numbers the documents of a stream of encoded documents in the order they are read.
+func numberEncoded(docs <-chan [][]int) <-chan encodedJob {
+	jobs := make(chan encodedJob, BUFFERSIZE)
+	go func() {
+		defer close(jobs)
+		i := 0
+		for sents := range docs {
+			jobs <- encodedJob{idx: i, sents: sents}
+			i++
+		}
+	}()
+	return jobs
+}
+
+// EncodeExtraction - parses and encodes a corpus once and for all, writing it to fullPath
+// so that cooc extraction can read it back without tokenizing it again.
+// OOV words are kept in the file, and documents are written in the order they were read.
+func EncodeExtraction(corpus *Corpus, parser *Parser, u *Unigram, fullPath string, logger *Logger) {
+	u.CheckParser(parser)
+	header := EncodedHeader{Checksum: u.checksum, Sentences: parser.SentenceMode()}
+	writer := ConstructEncodedWriter(fullPath, header)
+
+	// Number the documents so that the writer can put them back in order. A document takes
+	// one of BUFFERSIZE slots before it is handed out, and gives it back once it is written,
+	// so that workers cannot get more than BUFFERSIZE documents ahead of a slow one.
+	numbered := numberTexts(corpus.streamLabeled(logger))
+	slots := make(chan bool, BUFFERSIZE)
+	texts := make(chan encodedJob)
+	go func() {
+		defer close(texts)
+		for job := range numbered {
+			slots <- true
+			texts <- job
+		}
+	}()
+
+	// workers
+	logger.Log(fmt.Sprintf("Encoding documents with %d workers...", WORKERS))
+	encoded := make(chan encodedJob, BUFFERSIZE)
+	var wg sync.WaitGroup
+	for w := 0; w < WORKERS; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range texts {
+				sents := parser.ParseSentences(job.text)
+				job.text = ""
+				job.sents = make([][]int, len(sents))
+				for i, sent := range sents {
+					job.sents[i] = u.EncodeDocKeepOOV(sent)
+				}
+				encoded <- job
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(encoded)
+	}()
+
+	// writer, holding on to the documents that arrive before their turn; there are never
+	// more of them than slots.
+	pending := make(map[int][][]int)
+	next := 0
+	for job := range encoded {
+		pending[job.idx] = job.sents
+		for sents, ok := pending[next]; ok; sents, ok = pending[next] {
+			writer.WriteDoc(sents)
+			delete(pending, next)
+			<-slots
+			next++
+		}
+	}
+	writer.Close()
+	logger.Log(fmt.Sprintf("\tfinished encoding %d docs!", next))
+}
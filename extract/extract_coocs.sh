@@ -8,13 +8,8 @@ fi
 # For a 275MB .txt.gz file with context window w=5, this runs in about 4 minutes.
 # In $4 please pass any additional arguments you would like ./extract to take in.
 # The most important is, of course, window size/path to window!
+# All of the files go through the same workers, into a single set of .cooc gobs.
 
 exp=$3-run
-i=0
-for f in $2/*.gz; do
-	echo "RUNNING: ./extract -option cooc -e $f -U $1 -C ../data/coocs/$exp/$i.cooc $4"
-	./extract -option cooc -e $f -U $1 -C ../data/coocs/$exp/$i.cooc $4
-	i=$((i+1))
-done
-
-
+echo "RUNNING: ./extract -option cooc -e \"$2/*.gz\" -U $1 -C ../data/coocs/$exp/0.cooc $4"
+./extract -option cooc -e "$2/*.gz" -U $1 -C ../data/coocs/$exp/0.cooc $4
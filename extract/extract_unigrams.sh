@@ -5,7 +5,7 @@ if [[ -z $1 && -z $2 ]]; then
 	exit 0
 fi
 
-# Use this script to extract the unigram from the data, and then merge it.
+# Use this script to extract the unigram from the data, filtered to the vocabulary size.
 # If you want, use $3 as the argument for the vocabulary size!
 # It takes about 25 seconds to extract a unigram from a 275MB .txt.gz file.
 # It assumes that you are storing your unigrams in ../data/unigrams.
@@ -17,9 +17,4 @@ else
 fi
 
 mkdir ../data/unigrams/$1-run
-i=0
-for f in $2/*.gz; do
-	./extract -option unigram -e $f -U ../data/unigrams/$1-run/$i.unigram; 
-	i=$((i+1))
-done
-./extract -option unigram-merge -U ../data/unigrams/$1-run/ -v $vocabsize
+./extract -option unigram -e "$2/*.gz" -U ../data/unigrams/$1-run/merged.unigram -v $vocabsize
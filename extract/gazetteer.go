@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// A node of a trie over token sequences.
+type gazetteerNode struct {
+	children map[string]*gazetteerNode
+	end      bool // whether the tokens leading here are an entry.
+}
+
+// Gazetteer - a lexicon of multiword expressions that are joined into single tokens,
+// always taking the longest entry that starts at a word.
+type Gazetteer struct {
+	name    string
+	root    *gazetteerNode
+	entries int
+}
+
+// ConstructGazetteer - constructor, without any entries.
+func ConstructGazetteer() *Gazetteer {
+	return &Gazetteer{name: "none", root: &gazetteerNode{children: make(map[string]*gazetteerNode)}}
+}
+
+// LoadGazetteer - loads a lexicon with one expression per line, where lines starting with #
+// are comments. Each expression is split into tokens with tokenize, so that it matches the
+// text it is parsed the same way as; expressions of a single token are left out.
+func LoadGazetteer(fullPath string, tokenize func(string) []string) *Gazetteer {
+	bytes, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		panic(err)
+	}
+	g := ConstructGazetteer()
+	sum := sha1.Sum(bytes)
+	g.name = fmt.Sprintf("%x", sum[:6])
+	for _, line := range strings.Split(string(bytes), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if tokens := tokenize(line); len(tokens) > 1 {
+			g.Add(tokens)
+		}
+	}
+	return g
+}
+
+// Add - adds an expression, as its tokens.
+func (g *Gazetteer) Add(tokens []string) {
+	node := g.root
+	for _, token := range tokens {
+		child, ok := node.children[token]
+		if !ok {
+			child = &gazetteerNode{children: make(map[string]*gazetteerNode)}
+			node.children[token] = child
+		}
+		node = child
+	}
+	if !node.end {
+		node.end = true
+		g.entries++
+	}
+}
+
+// Name - the checksum of the lexicon file, recorded with the unigram.
+func (g *Gazetteer) Name() string {
+	return g.name
+}
+
+// Len - the number of expressions in the gazetteer.
+func (g *Gazetteer) Len() int {
+	return g.entries
+}
+
+// Apply - joins the longest expression starting at each word into a single token, left to right.
+func (g *Gazetteer) Apply(words []string) []string {
+	if g.entries == 0 {
+		return words
+	}
+	joined := words[:0] // safe in place, since an expression is never longer than its words.
+	for i := 0; i < len(words); {
+		longest := i + 1
+		node := g.root
+		for j := i; j < len(words); j++ {
+			if node = node.children[words[j]]; node == nil {
+				break
+			}
+			if node.end {
+				longest = j + 1
+			}
+		}
+		joined = append(joined, strings.Join(words[i:longest], PHRASESEP))
+		i = longest
+	}
+	return joined
+}
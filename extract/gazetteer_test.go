@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGazetteer(t *testing.T) {
+	path := writeCorpusFile(t, "entities.txt", "# places\nNew York\nNew York City\nSan Francisco Bay\nParis\n")
+	parser := ConstructParser()
+	parser.SetNormalizer(MakeNormalizer("lower", ""))
+	g := LoadGazetteer(path, parser.Tokens)
+	if g.Len() != 3 {
+		t.Errorf("Expected 3 multiword expressions, got %d\n", g.Len())
+	}
+	parser.SetGazetteer(g)
+
+	// The longest expression wins, and unfinished ones are left alone.
+	got := parser.ParseDoc("From New York City to new york and San Francisco")
+	want := []string{"from", "new_york_city", "to", "new_york", "and", "san", "francisco"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %q but got %q\n", want, got)
+	}
+	if parser.Config()["gazetteer"] != g.Name() || g.Name() == "none" {
+		t.Error("The gazetteer should be recorded in the parser config!")
+	}
+
+	// Expressions are never joined across sentences, in the unigram like anywhere else.
+	parser.SetGazetteer(LoadGazetteer(writeCorpusFile(t, "across.txt", "mat. the\n"), parser.Tokens))
+	parser.SetSentenceSplitter(MakeSentenceSplitter("rules", ""))
+	corpus := ConstructCorpus([]string{writeCorpusFile(t, "mat.txt", "on the mat. the end\n")})
+	u := UnigramExtraction(corpus, parser, ConstructLogger("silent"))
+	if _, oov := u.Encode("mat._the"); !oov {
+		t.Error("The unigram should not join expressions across sentences!")
+	}
+	if u.config["sentences"] != "rules" {
+		t.Error("The sentence mode should be recorded in the parser config!")
+	}
+}
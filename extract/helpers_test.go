@@ -5,7 +5,7 @@ import "testing"
 // LoadSampleWords - get sample words
 func LoadSampleWords() [][]string {
 	l := ConstructLogger("silent")
-	return ReadParseGz("../data/test_data/sample.txt.gz", false, l)
+	return ReadParseGz("../data/test_data/sample.txt.gz", ConstructParser(), l)
 }
 
 /* Check the newline parsing */
@@ -1,46 +1,203 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
+	"crypto/sha1"
 	"encoding/gob"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
 /* Basic IO helpers. */
 
-// ReadGzFile - reads a gzip file.
-func ReadGzFile(filename string) ([]byte, error) {
+// Magic bytes of the compression formats we know how to read.
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	// A bzip2 stream goes on with its level, 1 to 9, and then the magic of its first block
+	// (or of its end, if it is empty), so that text starting with "BZh" is not taken for it.
+	bzip2BlockMagic = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2EndMagic   = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+// MAGICLEN - how many leading bytes of a stream Compression needs to look at.
+const MAGICLEN = 10
+
+// Tar archives have their magic at the end of the first header block.
+var tarMagic = []byte("ustar")
+
+// TARHEADERLEN - how many leading bytes of a stream IsTar needs to look at.
+const TARHEADERLEN = 262
+
+// IsTar - whether the first bytes of a (decompressed) stream are those of a tar archive.
+func IsTar(header []byte) bool {
+	return len(header) >= TARHEADERLEN && bytes.Equal(header[257:TARHEADERLEN], tarMagic)
+}
+
+// Compression - names the compression format given the first bytes of a stream,
+// or returns "" for plain text.
+func Compression(magic []byte) string {
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(magic, zstdMagic):
+		return "zstd"
+	case isBzip2(magic):
+		return "bzip2"
+	case bytes.HasPrefix(magic, xzMagic):
+		return "xz"
+	}
+	return ""
+}
+
+func isBzip2(magic []byte) bool {
+	if len(magic) < MAGICLEN || !bytes.HasPrefix(magic, bzip2Magic) || magic[3] < '1' || magic[3] > '9' {
+		return false
+	}
+	return bytes.Equal(magic[4:MAGICLEN], bzip2BlockMagic) || bytes.Equal(magic[4:MAGICLEN], bzip2EndMagic)
+}
+
+// Decompress - wraps a stream with the decompressor matching its magic bytes.
+// Anything that is not gzip, zstd, bzip2 or xz is read as plain text.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(MAGICLEN) // short files just give fewer bytes.
+	switch Compression(magic) {
+	case "gzip":
+		return gzip.NewReader(br)
+	case "zstd":
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case "bzip2":
+		return ioutil.NopCloser(bzip2.NewReader(br)), nil
+	case "xz":
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(xr), nil
+	}
+	return ioutil.NopCloser(br), nil
+}
+
+// corpusFile - a decompressed stream that also closes its underlying file.
+type corpusFile struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (c *corpusFile) Close() error {
+	c.ReadCloser.Close()
+	return c.file.Close()
+}
+
+// OpenCorpusFile - opens a plain or compressed file for streaming, without reading it into memory.
+func OpenCorpusFile(filename string) (io.ReadCloser, error) {
 	fi, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
-	defer fi.Close()
-
-	fz, err := gzip.NewReader(fi)
+	r, err := Decompress(fi)
 	if err != nil {
+		fi.Close()
 		return nil, err
 	}
-	defer fz.Close()
+	return &corpusFile{r, fi}, nil
+}
 
-	s, err := ioutil.ReadAll(fz)
+// Moves an offset forward to the end of the document it falls in.
+func snapToDoc(fi *os.File, off, size int64, split bufio.SplitFunc) (int64, error) {
+	if off <= 0 {
+		return 0, nil
+	}
+	if off >= size {
+		return size, nil
+	}
+	// Whatever comes first from here is (the tail of) a document; we skip past it.
+	advanced := int64(0)
+	scanner := bufio.NewScanner(io.NewSectionReader(fi, off, size-off))
+	scanner.Buffer(make([]byte, 64*1024), MAXDOCLEN)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		advanced += int64(advance)
+		return advance, token, err
+	})
+	if !scanner.Scan() {
+		return size, scanner.Err()
+	}
+	return off + advanced, nil
+}
+
+// OpenShard - opens the k-th of n byte ranges of a plain text file for streaming.
+// Both ends of the range snap forward to the next document boundary found by split,
+// so no document is cut in half and the n ranges cover every document exactly once.
+func OpenShard(filename string, k, n int, split bufio.SplitFunc) (io.ReadCloser, error) {
+	fi, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, MAGICLEN)
+	nMagic, _ := fi.ReadAt(magic, 0)
+	if c := Compression(magic[:nMagic]); c != "" {
+		fi.Close()
+		return nil, fmt.Errorf("cannot take byte ranges of %s, it is compressed with %s", filename, c)
+	}
+	stat, err := fi.Stat()
 	if err != nil {
+		fi.Close()
 		return nil, err
 	}
-	return s, nil
+	size := stat.Size()
+	start, err := snapToDoc(fi, size*int64(k)/int64(n), size, split)
+	if err != nil {
+		fi.Close()
+		return nil, err
+	}
+	end, err := snapToDoc(fi, size*int64(k+1)/int64(n), size, split)
+	if err != nil {
+		fi.Close()
+		return nil, err
+	}
+	section := io.NewSectionReader(fi, start, end-start)
+	return &corpusFile{ioutil.NopCloser(section), fi}, nil
 }
 
 /* IO for Unigrams. */
 
+// CONFIGPREFIX - starts the lines with parser settings at the top of a unigram file.
+const CONFIGPREFIX = "# "
+
 // SerializeUnigram - writes the unigram to disk in a nice way
 func SerializeUnigram(u *Unigram, fullPath string) error {
 	if f, err := os.Create(fullPath); err == nil {
 		defer f.Close()
+		// parser settings come first, as comments.
+		keys := make([]string, 0, len(u.config))
+		for key := range u.config {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			f.WriteString(fmt.Sprintf("%s%s %s\n", CONFIGPREFIX, key, u.config[key]))
+		}
 		// oov is the header.
 		f.WriteString(fmt.Sprintf("%s %d\n", OOV, u.oovCount))
 		for _, code := range u.idx {
@@ -95,11 +252,29 @@ func LoadUnigram(fullPath string) *Unigram {
 		if bytes, err := ioutil.ReadAll(f); err == nil {
 			fullStr := string(bytes)
 			triples := strings.Split(fullStr, "\n")
+			config := make(map[string]string)
+			for len(triples) > 0 && strings.HasPrefix(triples[0], CONFIGPREFIX) {
+				setting := strings.SplitN(strings.TrimPrefix(triples[0], CONFIGPREFIX), " ", 2)
+				if len(setting) != 2 {
+					panic(fmt.Sprintf("Corrupted unigram setting! Str is: %s", triples[0]))
+				}
+				config[setting[0]] = setting[1]
+				triples = triples[1:]
+			}
+			// Older unigrams may have been extracted with -nodigits or -sentences, which they
+			// did not record.
+			for _, key := range []string{"normalize", "sentences"} {
+				if _, ok := config[key]; !ok {
+					config[key] = UNKNOWNSETTING
+				}
+			}
 
 			// minus 1 for trailing newline at end of a unigram doc
 			// another minus for the OOV header.
 			u := ConstructAllocatedUnigram(len(triples) - 2)
 			u.oovCount = parseOovCount(triples[0])
+			u.checksum = fmt.Sprintf("%x", sha1.Sum(bytes))
+			u.config = config
 			for _, trip := range triples[1:] {
 				if len(trip) == 0 {
 					continue
@@ -145,7 +320,7 @@ func SerializeCooc(c *Cooc, mincount float32, fullPath string, l *Logger) {
 		}
 		l.Log("\tserializing " + encodeFile.Name())
 		encoder := gob.NewEncoder(encodeFile)
-		err = encoder.Encode(CoocData{keys[start:end], vals[start:end]})
+		err = encoder.Encode(CoocData{Mode: c.Mode, Keys: keys[start:end], Vals: vals[start:end], Labels: c.Labels, Reach: c.Reach})
 		if err != nil {
 			panic(err)
 		}
@@ -169,15 +344,59 @@ func LoadCooc(into *Cooc, fullPath string, l *Logger) {
 
 // LoadSingleCooc - loads a single cooc file into a Cooc
 func LoadSingleCooc(into *Cooc, fullPath string) {
+	into.LoadCoocData(LoadCoocDataFile(fullPath))
+}
+
+// LoadCoocDataFile - loads the data of a single cooc file.
+func LoadCoocDataFile(fullPath string) CoocData {
 	decodeFile, err := os.Open(fullPath)
 	if err != nil {
 		panic(err)
 	}
+	defer decodeFile.Close()
 	coocData := CoocData{}
 	decoder := gob.NewDecoder(decodeFile)
 	decoder.Decode(&coocData)
-	into.LoadCoocData(coocData)
-	decodeFile.Close()
+	return coocData
+}
+
+// Writes out a key as its word codes, or as the words themselves if there is a unigram;
+// a directional key is followed by the side of the context, a positional one by its offset,
+// the context of a structured one is written as word@offset, that of a term-document
+// one is the document ID, and that of a word-label one is the label.
+func (c *Cooc) keyString(key int64, u *Unigram) string {
+	word := func(code int) string {
+		if u == nil {
+			return strconv.Itoa(code)
+		}
+		return u.Decode(code)
+	}
+	switch c.Mode {
+	case "directional":
+		k1, k2 := InverseCantor(key >> 1)
+		side := "left"
+		if key&1 == 1 {
+			side = "right"
+		}
+		return fmt.Sprintf("%s %s %s", word(k1), word(k2), side)
+	case "positional":
+		cantor, offset := SplitPositionalKey(key)
+		k1, k2 := InverseCantor(cantor)
+		return fmt.Sprintf("%s %s %+d", word(k1), word(k2), offset)
+	case "label":
+		k1, labelCode := InverseCantor(key)
+		return fmt.Sprintf("%s %s", word(k1), c.Labels[labelCode])
+	case "termdoc":
+		k1, docID := InverseCantor(key)
+		return fmt.Sprintf("%s %d", word(k1), docID)
+	case "structured":
+		k1, context := InverseCantor(key)
+		k2, offset := SplitStructuredContext(int64(context))
+		return fmt.Sprintf("%s %s@%+d", word(k1), word(k2), offset)
+	default:
+		k1, k2 := InverseCantor(key)
+		return fmt.Sprintf("%s %s", word(k1), word(k2))
+	}
 }
 
 // SaveCooc - saves it into easy-readable text format.
@@ -197,14 +416,7 @@ func SaveCooc(c *Cooc, u *Unigram, mincount float32, fullPath string) {
 			b = 0
 		}
 		if count >= mincount {
-			k1, k2 := InverseCantor(cantor)
-			if u == nil {
-				str.WriteString(fmt.Sprintf("%d %d %f\n", k1, k2, count))
-			} else {
-				s1 := u.Decode(k1)
-				s2 := u.Decode(k2)
-				str.WriteString(fmt.Sprintf("%s %s %f\n", s1, s2, count))
-			}
+			str.WriteString(fmt.Sprintf("%s %f\n", c.keyString(cantor, u), count))
 			b++
 		}
 		i++
@@ -1,6 +1,18 @@
 package main
 
-import "testing"
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
 
 func TestUnigramIO(t *testing.T) {
 	documents := LoadSampleWords()
@@ -25,7 +37,7 @@ func TestCoocIO(t *testing.T) {
 	documents := LoadSampleWords()
 	u := ExtractUnigram(documents)
 	win2 := MakeWindow(2, "")
-	c := CoocExtraction("../data/test_data/sample.txt.gz", u, win2, false, l)
+	c := CoocExtraction(ConstructCorpus([]string{"../data/test_data/sample.txt.gz"}), ConstructParser(), u, win2, l)
 
 	l.Log("Seriailizing...")
 	SerializeCooc(c, float32(5.0), "/tmp/ex.cooc", l)
@@ -45,9 +57,132 @@ func TestMerge(t *testing.T) {
 	documents := LoadSampleWords()
 	u := ExtractUnigram(documents)
 	win2 := MakeWindow(2, "")
-	c := CoocExtraction("../data/test_data/sample.txt.gz", u, win2, false, l)
+	c := CoocExtraction(ConstructCorpus([]string{"../data/test_data/sample.txt.gz"}), ConstructParser(), u, win2, l)
 	l.Log("Serializing...")
 	SerializeCooc(c, float32(5.0), "/tmp/ex.cooc", l)
 	l.Log("Merging...")
 	mergeCoocs(u, float32(5.0), "/tmp/", l)
 }
+
+func TestCompressionDetection(t *testing.T) {
+	text := "the cat sat\non the mat\n"
+	var gz, zs, xzb bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(text))
+	gw.Close()
+	zw, _ := zstd.NewWriter(&zs)
+	zw.Write([]byte(text))
+	zw.Close()
+	xw, _ := xz.NewWriter(&xzb)
+	xw.Write([]byte(text))
+	xw.Close()
+
+	// There is no bzip2 writer in the standard library, so this one is precomputed.
+	bz2 := []byte{0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x3e, 0x3c,
+		0xa9, 0xa3, 0x00, 0x00, 0x0a, 0xd1, 0x80, 0x00, 0x10, 0x40, 0x00, 0x2a, 0x43, 0x8c,
+		0x00, 0x20, 0x00, 0x21, 0xa9, 0xb5, 0x30, 0x64, 0x20, 0x1a, 0x69, 0xa1, 0x8a, 0x11,
+		0xad, 0x6e, 0x21, 0x60, 0xb4, 0x5f, 0x89, 0xe1, 0x77, 0x24, 0x53, 0x85, 0x09, 0x03,
+		0xe3, 0xca, 0x9a, 0x30}
+
+	streams := map[string][]byte{
+		"plain": []byte(text),
+		"gzip":  gz.Bytes(),
+		"zstd":  zs.Bytes(),
+		"xz":    xzb.Bytes(),
+		"bzip2": bz2,
+	}
+	// Text that merely starts like a bzip2 stream is still text.
+	bzText := "BZhang is a name\non the mat\n"
+	if c := Compression([]byte(bzText)); c != "" {
+		t.Errorf("Text starting with BZh should not be taken for %s!\n", c)
+	}
+	if r, err := Decompress(strings.NewReader(bzText)); err != nil {
+		t.Errorf("Could not open text starting with BZh: %s\n", err)
+	} else if got, _ := ioutil.ReadAll(r); string(got) != bzText {
+		t.Errorf("Text starting with BZh was changed to %q\n", got)
+	}
+	for name, data := range streams {
+		r, err := Decompress(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("Could not open %s stream: %s\n", name, err)
+			continue
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || string(got) != text {
+			t.Errorf("Bad %s decompression, got %q\n", name, got)
+		}
+	}
+}
+
+func TestOpenShard(t *testing.T) {
+	var text strings.Builder
+	for i := 0; i < 200; i++ {
+		text.WriteString(strings.Repeat("word ", i%13) + "end\n")
+	}
+	path := filepath.Join(t.TempDir(), "big.txt")
+	ioutil.WriteFile(path, []byte(text.String()), 0644)
+
+	// Concatenating every shard must give back the file, cut only at newlines.
+	for _, n := range []int{1, 2, 3, 7, 1000} {
+		var joined strings.Builder
+		for k := 0; k < n; k++ {
+			r, err := OpenShard(path, k, n, bufio.ScanLines)
+			if err != nil {
+				t.Fatal(err)
+			}
+			part, _ := ioutil.ReadAll(r)
+			r.Close()
+			if len(part) > 0 && part[len(part)-1] != '\n' {
+				t.Errorf("Shard %d/%d does not end on a newline!\n", k, n)
+			}
+			joined.Write(part)
+		}
+		if joined.String() != text.String() {
+			t.Errorf("Shards of %d do not add up to the original file!\n", n)
+		}
+	}
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(text.String()))
+	gw.Close()
+	gzPath := filepath.Join(t.TempDir(), "big.txt.gz")
+	ioutil.WriteFile(gzPath, gz.Bytes(), 0644)
+	if _, err := OpenShard(gzPath, 0, 2, bufio.ScanLines); err == nil {
+		t.Error("Should not be able to take byte ranges of a gzip file!")
+	}
+}
+
+func TestUnigramConfigIO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.unigram")
+	parser := ConstructParser()
+	parser.SetTokenizer(MakeTokenizer(`regex:\w+ \w+`))
+	u := ExtractUnigram([][]string{parser.ParseDoc("the cat sat on the mat")})
+	u.config = parser.Config()
+	SerializeUnigram(u, path)
+
+	u2 := LoadUnigram(path)
+	if u2.Len() != u.Len() || len(u2.decoder) != len(u.decoder) {
+		t.Errorf("Settings changed the unigram size from %d to %d!\n", u.Len(), u2.Len())
+	}
+	if diff := ConfigMismatch(u.config, u2.config); diff != "" {
+		t.Errorf("Settings changed after serializing, %s!\n", diff)
+	}
+	u2.CheckParser(parser)
+
+	// Old unigrams without settings are taken to be whitespace tokenized, and their
+	// normalization is unknown, since -nodigits was not recorded.
+	ConstructUnigram().CheckParser(ConstructParser())
+	old := filepath.Join(t.TempDir(), "old.unigram")
+	ioutil.WriteFile(old, []byte(fmt.Sprintf("%s 0\n0 the 2\n", OOV)), 0644)
+	nodigits := ConstructParser()
+	nodigits.SetNormalizer(MakeNormalizer("asciidigits", ""))
+	LoadUnigram(old).CheckParser(nodigits)
+	defer func() {
+		if recover() == nil {
+			t.Error("Should not accept a parser with a different tokenizer!")
+		}
+	}()
+	u2.CheckParser(ConstructParser())
+}
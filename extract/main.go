@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/pkg/profile"
@@ -15,42 +17,99 @@ const (
 	GOBLEN     = int(7 * 1e7) // max num of items for a .gob file. 70 million.
 	STRBUF     = int(1e6)     // max num of strs for a .txt file write buffer, 1 million.
 	OOV        = "<OOV>"      // default string for out-of-vocabulary.
-	BUFFERSIZE = 2500         // max number of threads used for the merging channels
+	BUFFERSIZE = 2500         // max number of docs waiting in the streaming channels
+	MAXDOCLEN  = int(1 << 28) // max num of bytes in a single document, 256 MB.
+	LOGEVERY   = int(1e6)     // log progress every million docs read.
+	STDIN      = "-"          // path that reads the corpus from stdin.
 )
 
-func loadExperimentPath(extractPath string) string {
-	var paths []string
+// WORKERS - number of goroutines parsing and counting documents.
+var WORKERS = runtime.NumCPU()
+
+// Expands a single path or glob pattern into the files it refers to.
+func expandPath(p string) []string {
+	if p == STDIN {
+		return []string{p}
+	}
+	if strings.ContainsAny(p, "*?[") {
+		matches, err := filepath.Glob(p)
+		if err != nil || len(matches) == 0 {
+			panic(fmt.Sprintf("Error: glob %s does not match any file!", p))
+		}
+		return matches
+	}
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		panic(fmt.Sprintf("Error: path %s does not exist!", p))
+	}
+	return []string{p}
+}
+
+// Gets all of the shards to extract from; accepts a .paths file (one path per line),
+// a space-separated list of paths, glob patterns, or any mix of the two.
+func loadExperimentPaths(extractPath string) []string {
+	var items []string
 	if strings.HasSuffix(extractPath, ".paths") {
 		if f, err := os.Open(extractPath); err == nil {
 			defer f.Close()
 			if bytes, err := ioutil.ReadAll(f); err == nil {
-				paths = strings.Split(string(bytes), "\n")
+				items = strings.Split(string(bytes), "\n")
 			}
 		} else {
 			panic("The .paths file does not exist!")
 		}
 	} else {
-		paths = make([]string, strings.Count(extractPath, " ")+1)
-		for i, p := range strings.Split(extractPath, " ") {
-			if _, err := os.Stat(p); os.IsNotExist(err) {
-				panic(fmt.Sprintf("Error: path %s does not exist!", p))
-			}
-			paths[i] = p
+		items = strings.Split(extractPath, " ")
+	}
+	var paths []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			paths = append(paths, expandPath(item)...)
 		}
 	}
-	if len(paths) > 1 {
-		panic("It is inefficient to parse multiple at once, do one at a time with a bash script.")
+	if len(paths) == 0 {
+		panic("No paths to extract from!")
 	}
-	return paths[0]
+	return paths
+}
+
+// Parses a "k/N" shard specification.
+func parseShard(spec string) (int, int) {
+	var k, n int
+	if _, err := fmt.Sscanf(spec, "%d/%d", &k, &n); err != nil {
+		panic(fmt.Sprintf("Shard %s should be formatted as k/N!", spec))
+	}
+	return k, n
+}
+
+// Builds the corpus to extract from, with its byte range if we are sharding.
+func loadCorpus(extractPath, shard, format, field, delim, label string, l *Logger) *Corpus {
+	exPaths := loadExperimentPaths(extractPath)
+	l.LogAll(fmt.Sprintf("Will extract from %d paths, delimited by %s:", len(exPaths), delim), exPaths)
+	corpus := ConstructCorpus(exPaths)
+	corpus.SetFormat(format, field)
+	corpus.SetDelimiter(MakeDelimiter(delim))
+	if label != "" {
+		corpus.SetLabel(label)
+	}
+	if shard != "" {
+		corpus.SetShard(parseShard(shard))
+	}
+	return corpus
 }
 
 // Does checks for the CLI.
-func checkArgs(opt, exP, uP, cP *string, v, w *int, winF *string) {
+func checkArgs(opt, exP, uP, cP, eP, pP, oP *string, v, w *int, winF, ctx, sents *string, cross *float64) {
 	emptyExp := *exP == ""
+	emptyOut := *oP == ""
+	emptyPhr := *pP == ""
+	emptyEnc := *eP == ""
 	emptyUni := *uP == ""
 	emptyCoo := *cP == ""
 	emptyVoc := *v <= 0
-	emptyWin := *w <= 0 && *winF == ""
+	emptyWin := *w <= 0 && *winF == "" && *ctx == "window"
+	if *cross > 0 && *sents == "" {
+		panic("Cross-sentence weights need sentences to cross (-sentences)!")
+	}
 	switch *opt {
 	case "unigram-merge":
 		if emptyUni || emptyVoc {
@@ -70,11 +129,40 @@ func checkArgs(opt, exP, uP, cP *string, v, w *int, winF *string) {
 		if emptyExp || emptyCoo || emptyWin || emptyUni {
 			panic("Cooc extraction needs exp, coocpath, unigram, and window! Missing!")
 		}
+	case "encode":
+		if emptyExp || emptyEnc || emptyUni {
+			panic("Encoding needs exp, encodedpath, and unigram! Missing!")
+		}
+	case "collapse":
+		if emptyCoo || emptyOut || emptyWin {
+			panic("Collapsing needs coocpath, output, and window! Missing!")
+		}
+	case "phrases":
+		if emptyExp || emptyPhr {
+			panic("Phrase extraction needs exp and phrasepath! Missing!")
+		}
 	default:
 		panic(fmt.Sprintf("Option %s is invalid!\n", *opt))
 	}
 }
 
+// Builds the window from whichever of the window options were given.
+func makeWindow(w int, wPath, scheme, expr string) *Window {
+	if expr != "" {
+		if scheme != "" {
+			panic("Ahh! Both -scheme and -window-expr provided!")
+		}
+		scheme = "expr:" + expr
+	}
+	if scheme == "" {
+		return MakeWindow(w, wPath)
+	}
+	if wPath != "" {
+		panic("Ahh! Multiple window options provided!")
+	}
+	return MakeSchemeWindow(w, scheme)
+}
+
 // Merge these boys!
 func mergeUnigrams(unigramPath string, vocabSize int, l *Logger) {
 	var u *Unigram
@@ -96,19 +184,30 @@ func mergeUnigrams(unigramPath string, vocabSize int, l *Logger) {
 	SerializeUnigram(fu, unigramPath+"merged.unigram")
 }
 
-// Merge those boys!
+// Merge those boys! Coocs of each mode are merged apart, into merged.cooc for plain
+// coocs and merged.<mode>.cooc for the others.
 func mergeCoocs(u *Unigram, mincount float32, coocsDir string, l *Logger) {
-	into := ConstructCooc()
+	into := make(map[string]*Cooc)
 	cFiles, _ := ioutil.ReadDir(coocsDir)
 	for _, file := range cFiles {
 		s := file.Name()
 		if strings.Contains(s, ".cooc") && !strings.Contains(s, "merged") {
 			l.Log(fmt.Sprintf("\tloading %s...", s))
-			LoadSingleCooc(into, coocsDir+s)
+			data := LoadCoocDataFile(coocsDir + s)
+			if into[data.Mode] == nil {
+				into[data.Mode] = ConstructCooc()
+			}
+			into[data.Mode].LoadCoocData(data)
+		}
+	}
+	for mode, c := range into {
+		name := "merged.cooc"
+		if mode != "" {
+			name = "merged." + mode + ".cooc"
 		}
+		l.Log("\tsaving coocs to " + name + "...")
+		SaveCooc(c, u, mincount, coocsDir+name)
 	}
-	l.Log("\tsaving coocs...")
-	SaveCooc(into, u, mincount, coocsDir+"merged.cooc")
 }
 
 func main() {
@@ -116,11 +215,14 @@ func main() {
 
 	// Required argument
 	extractOption := flag.String("option", "",
-		"option for extraction, \"unigram\" or \"cooc\"; add \"-merge\" to merge?")
+		"option for extraction, \"phrases\", \"unigram\", \"encode\" or \"cooc\"; add \"-merge\" to merge?\n"+
+			"or \"collapse\" to weight a positional cooc by a window")
 
 	// possibly required arguments
 	flag.StringVar(&extractPath, "e", "",
-		"path to the target gz file we will be extracting")
+		"path(s) to the target files we will be extracting (plain, gz, zst, bz2 or xz);\n"+
+			"a space-separated list, a glob, or a .paths file with one path per line;\n"+
+			"tar archives and directories give one document per member file; \"-\" reads stdin")
 
 	unigramPath := flag.String("U", "",
 		"path to the unigram to pre-load, if desired")
@@ -128,16 +230,64 @@ func main() {
 	coocPath := flag.String("C", "",
 		"path for where to save Coocs, if desired")
 
+	encodedPath := flag.String("E", "",
+		"path for where to save the encoded corpus (option \"encode\"), then pass it to cooc as -e")
+
+	gazetteerPath := flag.String("gazetteer", "",
+		"path to a lexicon of multiword expressions, one per line, joined into single tokens")
+
+	outputPath := flag.String("O", "",
+		"path for where to save the collapsed cooc (option \"collapse\", reading the cooc at -C)")
+
+	phrasesPath := flag.String("P", "",
+		"path for where to save the learned phrases (option \"phrases\"), or to load them from to\n"+
+			"join them into single tokens in the other options")
+
+	phraseIters := flag.Int("phraseiters", 1,
+		"number of phrase learning iterations, each one building longer phrases out of the last")
+
+	phraseDelta := flag.Float64("phrasedelta", 5,
+		"discount of the phrase score, (count(ab) - delta) / (count(a) * count(b)) * total words;\n"+
+			"words seen fewer times than it are never part of phrases")
+
+	phraseThreshold := flag.Float64("phrasethreshold", 100,
+		"minimum score of a phrase")
+
 	vocabSize := flag.Int("v", -1,
-		"desired size of the vocabulary to perform extraction")
+		"desired size of the vocabulary (unigram-merge, or unigram to filter right away)")
 
 	window := flag.Int("w", -1,
-		"window size, an integer indicating it (only dynamic weighting for now)")
+		"window size, an integer indicating it (dynamic weighting, unless -scheme is given)")
+
+	scheme := flag.String("scheme", "",
+		"weighting scheme of a window of size -w, for both sides or as \"LEFT,RIGHT\": \"uniform\",\n"+
+			"\"linear\", \"harmonic\", \"exp:R\" (R^(d-1)), \"gauss:S\" or \"expr:E\" (see -window-expr)")
+
+	windowExpr := flag.String("window-expr", "",
+		"weight of a context d words away in a window of size -w W, for both sides, as an\n"+
+			"expression of d and W, e.g. \"1/d^0.5\"; short for -scheme expr:E")
 
 	windowF := flag.String("window", "",
 		"path to a file containing window weights, formatted as shown in example.w")
 
+	delim := flag.String("delimiter", "newline",
+		"where documents end: \"newline\", \"blank\" (blank lines), \"regex:PATTERN\",\n"+
+			"or \"none\" (windows flow across lines)")
+
+	format := flag.String("format", "text",
+		"format of the input documents, \"text\" or \"jsonl\" (one JSON record per document)")
+
+	field := flag.String("field", "text",
+		"dot-separated path to the text in each JSONL record, e.g. \"meta.body\"")
+
+	shard := flag.String("shard", "",
+		"k/N, only extract from the k-th (0 <= k < N) of N byte ranges of each plain text file\n"+
+			"(or from every N-th member file of tar archives and directories)")
+
 	// Optional arguments.
+	flag.IntVar(&WORKERS, "workers", WORKERS,
+		"number of workers parsing and counting documents, shared by all shards")
+
 	debug := flag.Bool("debug", false,
 		"whether to run a debug profiler")
 
@@ -148,7 +298,80 @@ func main() {
 		"option for writing, printing, or silence [write, print, silent]")
 
 	replaceDigits := flag.Bool("nodigits", false,
-		"replace all digits with 0s during extraction")
+		"replace the digits 0-9 with 0s during extraction, short for adding \"asciidigits\" to -normalize")
+
+	normalize := flag.String("normalize", "none",
+		"comma-separated chain of normalization steps applied in order before tokenizing,\n"+
+			"from \"lower\", \"nfc\", \"nfkc\", \"accents\" (strip them), \"digits\" (fold those of any\n"+
+			"script to 0) and \"asciidigits\" (fold 0-9 to 0, like -nodigits);\n"+
+			"it is recorded in the unigram, and cooc must use the same one")
+
+	rules := flag.String("rules", "",
+		"path to a normalization rule file, with lines \"regex:PATTERN => REPLACEMENT\"\n"+
+			"(applied after -normalize) or \"VARIANT => CANONICAL\" (applied to tokens)")
+
+	placeholders := flag.String("placeholders", "none",
+		"comma-separated classes of spans replaced by a class token after normalizing, out of\n"+
+			"\"url\", \"email\", \"hashtag\", \"mention\" and \"num\" (e.g., <URL>)")
+
+	tokenizer := flag.String("tokenizer", "whitespace",
+		"how to split text into words: \"whitespace\", \"regex:PATTERN\" or \"unicode\" (UAX #29);\n"+
+			"it is recorded in the unigram, and cooc must use the same one")
+
+	sentences := flag.String("sentences", "",
+		"split documents into sentences that windows do not cross: \"rules\" (punctuation) or \"lines\"")
+
+	abbrevs := flag.String("abbrevs", "",
+		"path to a file of abbreviations (e.g. \"Dr.\") that do not end sentences, for -sentences rules")
+
+	crossWeight := flag.Float64("crossweight", 0,
+		"weight in [0, 1] of contexts across sentences relative to within them, with -sentences")
+
+	oovMode := flag.String("oov", "purge",
+		"what becomes of OOV words in cooc extraction: \"purge\" them, so windows reach past them,\n"+
+			"leave a \"gap\" that takes up its place in windows, or count them as the <OOV> \"token\"")
+
+	sample := flag.Float64("sample", 0,
+		"threshold t for randomly dropping frequent words before windowing, as in word2vec;\n"+
+			"a word with frequency f is dropped with probability 1-sqrt(t/f), e.g. 1e-5")
+
+	seed := flag.Int64("seed", 1,
+		"seed for the random choices of cooc extraction")
+
+	windowMode := flag.String("windowmode", "expected",
+		"with -w W (or -scheme linear), \"expected\" to weight contexts d words away by (W-d+1)/W, or \"sampled\" to\n"+
+			"draw a window size in [1, W] for each word and count the contexts within it, seeded by -seed")
+
+	context := flag.String("context", "window",
+		"what words are counted with: the words in their \"window\", every other word in their\n"+
+			"document (\"doc\"), the ID of their document (\"termdoc\", a term-document matrix),\n"+
+			"or the label of their document (\"label\", see -label)")
+
+	label := flag.String("label", "",
+		"where the label of each document is: the dot path to it in JSONL records, or \"lead\"\n"+
+			"for the leading field of text documents, which is then left out of their text")
+
+	docBase := flag.Int64("docbase", 0,
+		"ID of the first document with -context termdoc, so that corpora extracted separately\n"+
+			"(other than with -shard, which keeps IDs apart) get different IDs")
+
+	positional := flag.Bool("positional", false,
+		"count each context at its offset within the window, instead of adding up their weights,\n"+
+			"to weight them later with option \"collapse\"")
+
+	directional := flag.Bool("directional", false,
+		"count the contexts on the left of words apart from those on their right, writing them\n"+
+			"to two coocs, -C with .left and with .right appended")
+
+	structured := flag.Bool("structured", false,
+		"make contexts words at an offset, like cat@-2, as in structured skip-grams")
+
+	stopwords := flag.String("stopwords", "",
+		"stopwords filtered out during cooc extraction: \"english\", or a file of words")
+
+	stopMode := flag.String("stopmode", "clean",
+		"\"clean\" to remove stopwords before windowing, so windows reach further, or\n"+
+			"\"dirty\" to leave gaps that still count toward the distance between words")
 
 	mergeAsStr := flag.Bool("strkeep", false,
 		"pass when using option \"cooc-merge\" to save as strings, not idxs")
@@ -162,7 +385,10 @@ func main() {
 	flag.Parse()
 
 	// Check args.
-	checkArgs(extractOption, &extractPath, unigramPath, coocPath, vocabSize, window, windowF)
+	if WORKERS < 1 {
+		panic("Need at least one worker!")
+	}
+	checkArgs(extractOption, &extractPath, unigramPath, coocPath, encodedPath, phrasesPath, outputPath, vocabSize, window, windowF, context, sentences, crossWeight)
 
 	// TODO: pass to the logger all args and log them.
 	l := ConstructLogger(*logOption)
@@ -179,6 +405,22 @@ func main() {
 	// Now check if we can load the unigram file or if something else is happening.
 	var unigram *Unigram
 	uPth := *unigramPath
+	parser := ConstructParser()
+	if *replaceDigits && !strings.Contains(","+*normalize+",", ",asciidigits,") {
+		*normalize += ",asciidigits"
+	}
+	parser.SetNormalizer(MakeNormalizer(*normalize, *rules))
+	parser.SetPlaceholders(MakePlaceholders(*placeholders))
+	parser.SetTokenizer(MakeTokenizer(*tokenizer))
+	if *sentences != "" {
+		parser.SetSentenceSplitter(MakeSentenceSplitter(*sentences, *abbrevs))
+	}
+	if *gazetteerPath != "" {
+		parser.SetGazetteer(LoadGazetteer(*gazetteerPath, parser.Tokens))
+	}
+	if *phrasesPath != "" && *extractOption != "phrases" {
+		parser.SetPhrases(LoadPhrases(*phrasesPath))
+	}
 
 	switch *extractOption {
 	case "unigram-merge":
@@ -191,22 +433,78 @@ func main() {
 			mergeCoocs(nil, float32(*minNij), *coocPath, l)
 		}
 	case "unigram":
-		exPath := loadExperimentPath(extractPath)
-		l.Log(fmt.Sprintf("Will extract from path %s...", exPath))
+		corpus := loadCorpus(extractPath, *shard, *format, *field, *delim, *label, l)
 		if _, err := os.Stat(uPth); os.IsNotExist(err) {
 			l.Log("\textracting its unigram...")
-			unigram = UnigramExtraction(extractPath, *replaceDigits, l)
+			unigram = UnigramExtraction(corpus, parser, l)
+			if *vocabSize > 0 {
+				l.Log(fmt.Sprintf("\tfiltering to a vocabulary of %d...", *vocabSize))
+				unigram = FilterUnigram(unigram, *vocabSize)
+			}
 			l.Log("\tserializing its unigram...")
 			SerializeUnigram(unigram, uPth)
 		}
+	case "collapse":
+		c := ConstructCooc()
+		LoadCooc(c, *coocPath, l)
+		l.Log("Collapsing coocs...")
+		c = Collapse(c, makeWindow(*window, *windowF, *scheme, *windowExpr))
+		SerializeCooc(c, float32(*vminNij), *outputPath, l)
+	case "phrases":
+		corpus := loadCorpus(extractPath, *shard, *format, *field, *delim, *label, l)
+		phrases := PhraseExtraction(corpus, parser, *phraseIters, *phraseDelta, *phraseThreshold, l)
+		l.Log(fmt.Sprintf("Serializing %d phrases...", phrases.Len()))
+		SerializePhrases(phrases, *phrasesPath)
+	case "encode":
+		corpus := loadCorpus(extractPath, *shard, *format, *field, *delim, *label, l)
+		l.Log(fmt.Sprintf("Loading unigram from %s...", uPth))
+		unigram = LoadUnigram(uPth)
+		EncodeExtraction(corpus, parser, unigram, *encodedPath, l)
 	case "cooc":
-		exPath := loadExperimentPath(extractPath)
+		corpus := loadCorpus(extractPath, *shard, *format, *field, *delim, *label, l)
 		l.Log(fmt.Sprintf("Loading unigram from %s...", uPth))
 		unigram = LoadUnigram(uPth)
-		window := MakeWindow(*window, *windowF)
-		c := CoocExtraction(exPath, unigram, window, *replaceDigits, l)
+		unigram.SetOOVMode(*oovMode)
+		if *stopwords != "" {
+			unigram.SetStopwords(LoadStopwords(*stopwords), *stopMode)
+		}
+		unigram.SetSample(*sample, *seed)
+		corpus.SetDocBase(*docBase)
+		if *context == "label" && *label == "" {
+			panic("Word-label coocs need to know where the labels are, pass -label!")
+		}
+		var win *Window
+		if *context == "window" {
+			win = makeWindow(*window, *windowF, *scheme, *windowExpr)
+		} else {
+			win = MakeDocumentWindow(*context)
+		}
+		win.SetCrossWeight(float32(*crossWeight))
+		if *positional {
+			win.SetPositional()
+		}
+		if *directional {
+			win.SetDirectional()
+		}
+		if *structured {
+			win.SetStructured()
+		}
+		switch *windowMode {
+		case "expected":
+		case "sampled":
+			win.SetSampled(*seed)
+		default:
+			panic(fmt.Sprintf("Window mode %s is invalid!", *windowMode))
+		}
+		c := CoocExtraction(corpus, parser, unigram, win, l)
 		l.Log("Serializing coocs...")
-		SerializeCooc(c, float32(*vminNij), *coocPath, l)
+		if *directional {
+			left, right := SplitDirections(c)
+			SerializeCooc(left, float32(*vminNij), *coocPath+".left", l)
+			SerializeCooc(right, float32(*vminNij), *coocPath+".right", l)
+		} else {
+			SerializeCooc(c, float32(*vminNij), *coocPath, l)
+		}
 	}
 	l.Log("Finished.")
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadExperimentPaths(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"a.txt.gz", "b.txt.gz", "c.txt.gz"}
+	for _, n := range names {
+		ioutil.WriteFile(filepath.Join(dir, n), []byte{}, 0644)
+	}
+
+	if paths := loadExperimentPaths(filepath.Join(dir, "*.gz")); len(paths) != 3 {
+		t.Errorf("Glob should give 3 paths but got %d!\n", len(paths))
+	}
+	both := filepath.Join(dir, names[0]) + " " + filepath.Join(dir, names[2])
+	if paths := loadExperimentPaths(both); len(paths) != 2 {
+		t.Errorf("List should give 2 paths but got %d!\n", len(paths))
+	}
+
+	// Manifests can mix plain paths and globs, and may have blank lines.
+	manifest := filepath.Join(dir, "shards.paths")
+	contents := filepath.Join(dir, names[1]) + "\n\n" + filepath.Join(dir, "[ac]*.gz") + "\n"
+	ioutil.WriteFile(manifest, []byte(contents), 0644)
+	paths := loadExperimentPaths(manifest)
+	if len(paths) != 3 || paths[0] != filepath.Join(dir, names[1]) {
+		t.Errorf("Bad .paths manifest loading, got %s\n", paths)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Steps that can be chained in a Normalizer, applied to text before it is tokenized.
+var normalizeSteps = map[string]func(string) string{
+	"lower":   strings.ToLower,
+	"nfc":     norm.NFC.String,
+	"nfkc":    norm.NFKC.String,
+	"accents": stripAccents,
+	"digits":  foldDigits,
+	// what -nodigits has always done, kept apart so that its vocabularies do not change.
+	"asciidigits": foldASCIIDigits,
+}
+
+// Removes the combining marks of decomposed text, e.g. "café" becomes "cafe".
+func stripAccents(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return norm.NFC.String(b.String())
+}
+
+// Replaces every decimal digit, in any script, with 0.
+func foldDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return '0'
+		}
+		return r
+	}, s)
+}
+
+// Replaces every ASCII digit, 0 to 9, with 0.
+func foldASCIIDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return '0'
+		}
+		return r
+	}, s)
+}
+
+// A regexp rewrite from a rule file.
+type rewriteRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// Normalizer - a chain of normalization steps applied to text before it is tokenized,
+// then the regexp rewrites of a rule file, and after tokenizing, its exact mappings
+// of variant tokens to canonical ones.
+type Normalizer struct {
+	name     string
+	steps    []func(string) string
+	rules    []rewriteRule
+	variants map[string]string
+}
+
+// Loads a rule file; each line is either "regex:PATTERN => REPLACEMENT" or
+// "VARIANT => CANONICAL", and lines starting with # are comments.
+func (n *Normalizer) loadRules(rulesPath string) {
+	bytes, err := ioutil.ReadFile(rulesPath)
+	if err != nil {
+		panic(err)
+	}
+	for _, line := range strings.Split(string(bytes), "\n") {
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		rule := strings.SplitN(line, " => ", 2)
+		if len(rule) != 2 {
+			panic(fmt.Sprintf("Rule %q should be formatted as \"FROM => TO\"!", line))
+		}
+		if strings.HasPrefix(rule[0], "regex:") {
+			re := regexp.MustCompile(strings.TrimPrefix(rule[0], "regex:"))
+			n.rules = append(n.rules, rewriteRule{re, rule[1]})
+			continue
+		}
+		variant, canonical := strings.TrimSpace(rule[0]), strings.TrimSpace(rule[1])
+		if strings.ContainsAny(variant+canonical, " \t") || canonical == "" {
+			panic(fmt.Sprintf("Rule %q maps between tokens, so it cannot have whitespace!", line))
+		}
+		n.variants[variant] = canonical
+	}
+	// The rules are named by their contents, so that the same rules anywhere match.
+	sum := sha1.Sum(bytes)
+	n.name += fmt.Sprintf("+rules:%x", sum[:6])
+}
+
+// MakeNormalizer - creates a Normalizer from a comma-separated chain of steps, applied in
+// order; each one of "lower", "nfc", "nfkc", "accents" (strip them), "digits" (fold the
+// digits of any script to 0) or "asciidigits" (fold only 0-9 to 0, like -nodigits).
+// rulesPath is an optional rule file applied after the steps.
+func MakeNormalizer(spec, rulesPath string) *Normalizer {
+	n := Normalizer{variants: make(map[string]string)}
+	var names []string
+	for _, step := range strings.Split(spec, ",") {
+		if step = strings.TrimSpace(step); step == "" || step == "none" {
+			continue
+		}
+		f, ok := normalizeSteps[step]
+		if !ok {
+			panic(fmt.Sprintf("Normalization step %s is invalid!", step))
+		}
+		n.steps = append(n.steps, f)
+		names = append(names, step)
+	}
+	n.name = strings.Join(names, ",")
+	if len(names) == 0 {
+		n.name = "none"
+	}
+	if rulesPath != "" {
+		n.loadRules(rulesPath)
+	}
+	return &n
+}
+
+// Name - the chain of steps and the checksum of the rules, recorded with the unigram.
+func (n *Normalizer) Name() string {
+	return n.name
+}
+
+// Normalize - applies the steps and then the regexp rewrites to text.
+func (n *Normalizer) Normalize(text string) string {
+	for _, step := range n.steps {
+		text = step(text)
+	}
+	for _, rule := range n.rules {
+		text = rule.re.ReplaceAllString(text, rule.replacement)
+	}
+	return text
+}
+
+// Canonicalize - maps the variant tokens to their canonical forms, in place.
+func (n *Normalizer) Canonicalize(tokens []string) []string {
+	if len(n.variants) == 0 {
+		return tokens
+	}
+	for i, token := range tokens {
+		if canonical, ok := n.variants[token]; ok {
+			tokens[i] = canonical
+		}
+	}
+	return tokens
+}
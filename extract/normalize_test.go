@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizer(t *testing.T) {
+	text := "Ｃafé Ⅻ costs ٣5 €"
+	expected := map[string]string{
+		"none":               text,
+		"lower":              "ｃafé ⅻ costs ٣5 €",
+		"nfkc":               "Café XII costs ٣5 €",
+		"nfkc,lower,accents": "cafe xii costs ٣5 €",
+		"digits":             "Ｃafé Ⅻ costs 00 €",
+		"asciidigits":        "Ｃafé Ⅻ costs ٣0 €",
+	}
+	for spec, normalized := range expected {
+		if got := MakeNormalizer(spec, "").Normalize(text); got != normalized {
+			t.Errorf("Normalizer %s: expected %q but got %q\n", spec, normalized, got)
+		}
+	}
+
+	// Rule files rewrite the text first, then map variant tokens to canonical ones.
+	rulesPath := filepath.Join(t.TempDir(), "rules.txt")
+	rules := "# spelling\nregex:(\\d+)% => $1 percent\ncolour => color\nU.S. => US\n"
+	if err := ioutil.WriteFile(rulesPath, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	parser := ConstructParser()
+	parser.SetNormalizer(MakeNormalizer("lower", rulesPath))
+	got := parser.ParseDoc("The colour of 50% of the U.S.")
+	want := []string{"the", "color", "of", "50", "percent", "of", "the", "u.s."}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %q but got %q\n", want, got)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("Expected token %q but got %q\n", want[i], got[i])
+		}
+	}
+
+	// A cooc extraction has to normalize the same way as its unigram.
+	u := ConstructUnigram()
+	u.config = parser.Config()
+	u.CheckParser(parser)
+	defer func() {
+		if recover() == nil {
+			t.Error("Should not accept a parser that normalizes differently!")
+		}
+	}()
+	other := ConstructParser()
+	other.SetNormalizer(MakeNormalizer("lower", ""))
+	u.CheckParser(other)
+}
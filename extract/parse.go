@@ -1,10 +1,5 @@
 package main
 
-import (
-	"regexp"
-	"strings"
-)
-
 type docMerger struct {
 	nDocs    int
 	realDocs int
@@ -24,8 +19,114 @@ func (m *docMerger) listen() {
 	m.done <- true
 }
 
+// Parser - turns document strings into words, and optionally into sentences of words.
+type Parser struct {
+	normalizer   *Normalizer
+	placeholders *Placeholders
+	tokenizer    Tokenizer
+	gazetteer    *Gazetteer
+	phrases      *Phrases
+	sentences    *SentenceSplitter // nil if documents are not split into sentences.
+}
+
+// ConstructParser - constructor, by default documents are not normalized, have no
+// placeholders, are split into words at whitespace, have no gazetteer or phrases,
+// and are not split into sentences.
+func ConstructParser() *Parser {
+	return &Parser{
+		normalizer:   MakeNormalizer("none", ""),
+		placeholders: MakePlaceholders("none"),
+		tokenizer:    WhitespaceTokenizer{},
+		gazetteer:    ConstructGazetteer(),
+		phrases:      ConstructPhrases()}
+}
+
+// SetNormalizer - makes the parser normalize text with n before tokenizing it.
+func (p *Parser) SetNormalizer(n *Normalizer) {
+	p.normalizer = n
+}
+
+// SetPlaceholders - makes the parser replace noisy spans with class tokens, once the text
+// is normalized and before it is tokenized.
+func (p *Parser) SetPlaceholders(ph *Placeholders) {
+	p.placeholders = ph
+}
+
+// SetTokenizer - makes the parser split text into words with t.
+func (p *Parser) SetTokenizer(t Tokenizer) {
+	p.tokenizer = t
+}
+
+// SetGazetteer - makes the parser join the expressions of g into single tokens,
+// before the phrases.
+func (p *Parser) SetGazetteer(g *Gazetteer) {
+	p.gazetteer = g
+}
+
+// SetPhrases - makes the parser join the words of phrases into single tokens.
+func (p *Parser) SetPhrases(ph *Phrases) {
+	p.phrases = ph
+}
+
+// Config - the settings of the parser that change which words come out of it,
+// to be recorded with a unigram so that later stages parse in the same way; sentences
+// matter since multiword expressions are never joined across them.
+func (p *Parser) Config() map[string]string {
+	sentences := p.SentenceMode()
+	if sentences == "" {
+		sentences = "none"
+	}
+	return map[string]string{
+		"gazetteer":    p.gazetteer.Name(),
+		"normalize":    p.normalizer.Name(),
+		"phrases":      p.phrases.Name(),
+		"placeholders": p.placeholders.Name(),
+		"sentences":    sentences,
+		"tokenizer":    p.tokenizer.Name(),
+	}
+}
+
+// SetSentenceSplitter - makes ParseSentences split documents with s.
+func (p *Parser) SetSentenceSplitter(s *SentenceSplitter) {
+	p.sentences = s
+}
+
+// SentenceMode - the mode of the sentence splitter, or "" if documents are not split.
+func (p *Parser) SentenceMode() string {
+	if p.sentences == nil {
+		return ""
+	}
+	return p.sentences.Mode()
+}
+
+// Tokens - parses text into words, before any multiword expressions are joined.
+func (p *Parser) Tokens(s string) []string {
+	words := p.placeholders.Replace(p.normalizer.Normalize(s), p.tokenizer.Tokenize)
+	return p.normalizer.Canonicalize(words)
+}
+
+// ParseDoc - parses a single document into words.
+func (p *Parser) ParseDoc(s string) []string {
+	return p.phrases.Apply(p.gazetteer.Apply(p.Tokens(s)))
+}
+
+// ParseSentences - parses a single document into its sentences of words, dropping
+// empty ones; without a sentence splitter the whole document is one sentence.
+func (p *Parser) ParseSentences(s string) [][]string {
+	if p.sentences == nil {
+		return [][]string{p.ParseDoc(s)}
+	}
+	var sents [][]string
+	for _, sent := range p.sentences.Split(s) {
+		if words := p.ParseDoc(sent); len(words) > 0 {
+			sents = append(sents, words)
+		}
+	}
+	return sents
+}
+
 // Parse - parses documents into words
-func Parse(documents []string, replaceDigits bool) [][]string {
+func Parse(documents []string, p *Parser) [][]string {
 	merger := docMerger{
 		nDocs: len(documents),
 		state: make([][]string, 0, len(documents)),
@@ -33,17 +134,10 @@ func Parse(documents []string, replaceDigits bool) [][]string {
 		done:  make(chan bool)}
 	go merger.listen()
 
-	// Regexp thing if we are replacing digits with 0s.
-	re := regexp.MustCompile("[0-9]")
-
 	// Now send all the jobs.
 	for _, docStr := range documents {
 		go func(s string) {
-			if replaceDigits {
-				s = re.ReplaceAllString(s, "0")
-			}
-			words := strings.Fields(s)
-			merger.input <- words
+			merger.input <- p.ParseDoc(s)
 		}(docStr)
 	}
 	<-merger.done
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PHRASESEP - joins the words of a phrase into a single token, e.g. "new_york".
+const PHRASESEP = "_"
+
+// PHRASEITER - starts the section of each iteration in a phrase file.
+const PHRASEITER = "# iteration"
+
+type bigram [2]string
+
+// Phrases - bigrams that are joined into single tokens, learned over several iterations;
+// each iteration is applied to the tokens that come out of the previous ones, so that
+// longer phrases like "new_york_times" are built out of shorter ones.
+type Phrases struct {
+	name  string
+	iters []map[bigram]float64 // score of each phrase, by iteration.
+}
+
+// ConstructPhrases - constructor, without any phrases.
+func ConstructPhrases() *Phrases {
+	return &Phrases{name: "none"}
+}
+
+// Name - the checksum of the phrase file, recorded with the unigram.
+func (p *Phrases) Name() string {
+	return p.name
+}
+
+// Len - the number of phrases over all of the iterations.
+func (p *Phrases) Len() int {
+	n := 0
+	for _, phrases := range p.iters {
+		n += len(phrases)
+	}
+	return n
+}
+
+// Apply - joins the phrases in a list of words, iteration by iteration, left to right.
+func (p *Phrases) Apply(words []string) []string {
+	for _, phrases := range p.iters {
+		joined := words[:0] // safe in place, since a phrase is never longer than its words.
+		for i := 0; i < len(words); i++ {
+			if i+1 < len(words) {
+				if _, ok := phrases[bigram{words[i], words[i+1]}]; ok {
+					joined = append(joined, words[i]+PHRASESEP+words[i+1])
+					i++
+					continue
+				}
+			}
+			joined = append(joined, words[i])
+		}
+		words = joined
+	}
+	return words
+}
+
+// Running counts of words and bigrams for learning phrases.
+type phraseCounts struct {
+	words   map[string]int
+	bigrams map[bigram]int
+	total   int
+}
+
+func constructPhraseCounts() *phraseCounts {
+	return &phraseCounts{words: make(map[string]int), bigrams: make(map[bigram]int)}
+}
+
+// Counts the words of a sentence and its bigrams.
+func (c *phraseCounts) add(words []string) {
+	for i, word := range words {
+		c.words[word]++
+		if i > 0 {
+			c.bigrams[bigram{words[i-1], word}]++
+		}
+	}
+	c.total += len(words)
+}
+
+func (c *phraseCounts) merge(c2 *phraseCounts) {
+	for word, count := range c2.words {
+		c.words[word] += count
+	}
+	for b, count := range c2.bigrams {
+		c.bigrams[b] += count
+	}
+	c.total += c2.total
+}
+
+// Scores the bigrams as in word2phrase, (count(ab) - delta) / (count(a) * count(b)), times the
+// total number of words so that the threshold does not depend on the size of the corpus.
+// Bigrams with a word seen fewer than delta times are left out.
+func (c *phraseCounts) score(delta, threshold float64) map[bigram]float64 {
+	phrases := make(map[bigram]float64)
+	for b, count := range c.bigrams {
+		ca, cb := float64(c.words[b[0]]), float64(c.words[b[1]])
+		if ca < delta || cb < delta {
+			continue
+		}
+		score := (float64(count) - delta) / (ca * cb) * float64(c.total)
+		if score > threshold {
+			phrases[b] = score
+		}
+	}
+	return phrases
+}
+
+/* IO for phrase files: a section for each iteration, started by a PHRASEITER line,
+with a line "A B SCORE" for each phrase, sorted by decreasing score. */
+
+// SerializePhrases - writes the phrases to a file.
+func SerializePhrases(p *Phrases, fullPath string) {
+	f, err := os.Create(fullPath)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for i, phrases := range p.iters {
+		sorted := make([]bigram, 0, len(phrases))
+		for b := range phrases {
+			sorted = append(sorted, b)
+		}
+		sort.Slice(sorted, func(j, k int) bool {
+			if phrases[sorted[j]] != phrases[sorted[k]] {
+				return phrases[sorted[j]] > phrases[sorted[k]]
+			}
+			return sorted[j][0]+" "+sorted[j][1] < sorted[k][0]+" "+sorted[k][1]
+		})
+		fmt.Fprintf(w, "%s %d\n", PHRASEITER, i+1)
+		for _, b := range sorted {
+			fmt.Fprintf(w, "%s %s %f\n", b[0], b[1], phrases[b])
+		}
+	}
+	if err := w.Flush(); err != nil {
+		panic(err)
+	}
+}
+
+// LoadPhrases - loads the phrases of a file written by SerializePhrases.
+func LoadPhrases(fullPath string) *Phrases {
+	bytes, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha1.Sum(bytes)
+	p := Phrases{name: fmt.Sprintf("%x", sum[:6])}
+	for _, line := range strings.Split(string(bytes), "\n") {
+		if strings.HasPrefix(line, PHRASEITER) {
+			p.iters = append(p.iters, make(map[bigram]float64))
+			continue
+		}
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || len(p.iters) == 0 {
+			panic(fmt.Sprintf("Corrupted phrase file %s! Line is: %s", fullPath, line))
+		}
+		score, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			panic(err)
+		}
+		p.iters[len(p.iters)-1][bigram{fields[0], fields[1]}] = score
+	}
+	return &p
+}
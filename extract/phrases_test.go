@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPhrases(t *testing.T) {
+	var docs []string
+	for i := 0; i < 50; i++ {
+		docs = append(docs, fmt.Sprintf("w%d new york times v%d", i%25, i%25))
+	}
+	path := writeCorpusFile(t, "news.txt", strings.Join(docs, "\n"))
+
+	// The first iteration finds "new york", the second one "new_york times".
+	parser := ConstructParser()
+	phrases := PhraseExtraction(ConstructCorpus([]string{path}), parser, 2, 3, 3, ConstructLogger("silent"))
+	if len(phrases.iters) != 2 || len(phrases.iters[1]) != 1 {
+		t.Fatalf("Expected phrases in both iterations, got %v\n", phrases.iters)
+	}
+	if _, ok := phrases.iters[1][bigram{"new_york", "times"}]; !ok {
+		t.Errorf("Expected to build new_york_times, got %v\n", phrases.iters[1])
+	}
+
+	phrasesPath := filepath.Join(t.TempDir(), "phrases.txt")
+	SerializePhrases(phrases, phrasesPath)
+	loaded := LoadPhrases(phrasesPath)
+	if loaded.Len() != phrases.Len() || loaded.Name() == "none" {
+		t.Errorf("Expected %d phrases after loading, got %d\n", phrases.Len(), loaded.Len())
+	}
+	parser = ConstructParser()
+	parser.SetPhrases(loaded)
+	got := parser.ParseDoc("the new york times of new york")
+	want := []string{"the", "new_york_times", "of", "new_york"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %q but got %q\n", want, got)
+	}
+	if parser.Config()["phrases"] != loaded.Name() {
+		t.Error("Phrases should be recorded in the parser config!")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A class of noisy spans that are all replaced by the same token.
+type placeholderClass struct {
+	token   string
+	pattern string
+}
+
+// Classes that can be toggled in a Placeholders.
+var placeholderClasses = map[string]placeholderClass{
+	"url":     {"<URL>", `(?:[a-zA-Z][a-zA-Z0-9+.-]*://|www\.)[^\s<>"]*[^\s<>".,;:!?'()\[\]]`},
+	"email":   {"<EMAIL>", `[\w.+-]+@[\w-]+(?:\.[\w-]+)+`},
+	"hashtag": {"<HASHTAG>", `\B#\w+`},
+	"mention": {"<MENTION>", `\B@\w+`},
+	"num":     {"<NUM>", `(?:\B[-+])?\b\d+(?:[.,:/]\d+)*\b`},
+}
+
+// Order in which the classes are tried when two of them match at the same place.
+var placeholderOrder = []string{"url", "email", "hashtag", "mention", "num"}
+
+// Placeholders - replaces the spans of text matched by the chosen classes with
+// their class tokens, which are kept as they are instead of being tokenized.
+type Placeholders struct {
+	name    string
+	re      *regexp.Regexp
+	classes []string // token of each capturing group of re.
+}
+
+// MakePlaceholders - creates Placeholders from a comma-separated list of classes, out of
+// "url", "email", "hashtag", "mention" (of a user handle) and "num" (of ASCII digits, so fold
+// the others first with the "digits" normalization step); "none" for no classes.
+func MakePlaceholders(spec string) *Placeholders {
+	chosen := make(map[string]bool)
+	for _, class := range strings.Split(spec, ",") {
+		if class = strings.TrimSpace(class); class == "" || class == "none" {
+			continue
+		}
+		if _, ok := placeholderClasses[class]; !ok {
+			panic(fmt.Sprintf("Placeholder class %s is invalid!", class))
+		}
+		chosen[class] = true
+	}
+	if len(chosen) == 0 {
+		return &Placeholders{name: "none"}
+	}
+
+	p := Placeholders{}
+	var names, patterns []string
+	for _, class := range placeholderOrder {
+		if chosen[class] {
+			names = append(names, class)
+			patterns = append(patterns, "("+placeholderClasses[class].pattern+")")
+			p.classes = append(p.classes, placeholderClasses[class].token)
+		}
+	}
+	sort.Strings(names)
+	p.name = strings.Join(names, ",")
+	p.re = regexp.MustCompile(strings.Join(patterns, "|"))
+	return &p
+}
+
+// Name - the sorted list of classes, recorded with the unigram.
+func (p *Placeholders) Name() string {
+	return p.name
+}
+
+// Replace - tokenizes the text around the spans of the placeholder classes with tokenize,
+// putting the class token of each span in its place.
+func (p *Placeholders) Replace(text string, tokenize func(string) []string) []string {
+	if p.re == nil {
+		return tokenize(text)
+	}
+	var words []string
+	start := 0
+	for _, match := range p.re.FindAllStringSubmatchIndex(text, -1) {
+		words = append(words, tokenize(text[start:match[0]])...)
+		for group := range p.classes {
+			if match[2+2*group] >= 0 {
+				words = append(words, p.classes[group])
+				break
+			}
+		}
+		start = match[1]
+	}
+	return append(words, tokenize(text[start:])...)
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestPlaceholders(t *testing.T) {
+	text := "Mail bob.smith@example.org or see https://example.org/a?b=1, #NLP by @kiankd in 2019: 3.5 -2 B52"
+	expected := map[string][]string{
+		"none": {"Mail", "bob.smith@example.org", "or", "see", "https://example.org/a?b=1,",
+			"#NLP", "by", "@kiankd", "in", "2019:", "3.5", "-2", "B52"},
+		"url,email": {"Mail", "<EMAIL>", "or", "see", "<URL>", ",",
+			"#NLP", "by", "@kiankd", "in", "2019:", "3.5", "-2", "B52"},
+		"num,mention,hashtag": {"Mail", "bob.smith@example.org", "or", "see", "https://example.org/a?b=", "<NUM>", ",",
+			"<HASHTAG>", "by", "<MENTION>", "in", "<NUM>", ":", "<NUM>", "<NUM>", "B52"},
+	}
+	for spec, tokens := range expected {
+		parser := ConstructParser()
+		parser.SetPlaceholders(MakePlaceholders(spec))
+		got := parser.ParseDoc(text)
+		if len(got) != len(tokens) {
+			t.Errorf("Placeholders %s: expected %q but got %q\n", spec, tokens, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tokens[i] {
+				t.Errorf("Placeholders %s: expected token %q but got %q\n", spec, tokens[i], got[i])
+			}
+		}
+	}
+
+	// Class tokens are not split by tokenizers that drop punctuation.
+	parser := ConstructParser()
+	parser.SetTokenizer(MakeTokenizer("unicode"))
+	parser.SetPlaceholders(MakePlaceholders("url"))
+	if got := parser.ParseDoc("go to www.example.com now"); len(got) != 4 || got[2] != "<URL>" {
+		t.Errorf("Class tokens should not be tokenized, got %q\n", got)
+	}
+	if MakePlaceholders("url,num").Name() != MakePlaceholders("num, url").Name() {
+		t.Error("The same classes should have the same name in any order!")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import "fmt"
+
+/* Positional coocs keep a count for each offset of a context from its word, so that any
+window weighting can be applied after extraction. Structured coocs have contexts made of
+a word and its offset instead, like "cat@-2", as in structured skip-grams. */
+
+// MAXOFFSET - the furthest a positional window can reach on either side.
+const MAXOFFSET = 127
+
+// PositionalKey - the key of a word and its context at a signed offset, negative to the left.
+func PositionalKey(cantor int64, offset int) int64 {
+	return cantor<<8 | int64(offset+MAXOFFSET+1)
+}
+
+// SplitPositionalKey - gets back the cantor pairing and the offset of a positional key.
+func SplitPositionalKey(key int64) (int64, int) {
+	return key >> 8, int(key&0xff) - MAXOFFSET - 1
+}
+
+// Adds the contexts of a document at each offset, with the window's unit weight.
+func (c *Cooc) addPositional(encodedDoc []int, win Window) {
+	for offset := 1; offset <= len(win.lWeights) || offset <= len(win.rWeights); offset++ {
+		for i := offset; i < len(encodedDoc); i++ {
+			left, right := encodedDoc[i-offset], encodedDoc[i]
+			if left < 0 || right < 0 {
+				continue
+			}
+			if offset <= len(win.lWeights) {
+				c.Counter[PositionalKey(CantorPairing(int64(right), int64(left)), -offset)] += win.unit
+			}
+			if offset <= len(win.rWeights) {
+				c.Counter[PositionalKey(CantorPairing(int64(left), int64(right)), offset)] += win.unit
+			}
+		}
+	}
+}
+
+// Collapse - weights the counts of a positional Cooc by the window, adding up the offsets of
+// each pair into a plain Cooc, just as if it had been extracted with the window. The window
+// cannot weight offsets beyond the reach of the Cooc, which were never counted.
+func Collapse(c *Cooc, win *Window) *Cooc {
+	if c.Mode != "positional" {
+		panic("Can only collapse positional coocs!")
+	}
+	for side, weights := range [][]float32{win.lWeights, win.rWeights} {
+		for offset := c.Reach[side] + 1; offset <= len(weights); offset++ {
+			if weights[offset-1] > 0 {
+				panic(fmt.Sprintf("Cannot collapse with weights beyond the offsets -%d to +%d that were extracted!",
+					c.Reach[0], c.Reach[1]))
+			}
+		}
+	}
+	collapsed := ConstructCooc()
+	for key, count := range c.Counter {
+		cantor, offset := SplitPositionalKey(key)
+		weights := win.rWeights
+		if offset < 0 {
+			weights, offset = win.lWeights, -offset
+		}
+		if offset <= len(weights) && weights[offset-1] > 0 {
+			collapsed.Counter[cantor] += weights[offset-1] * count
+		}
+	}
+	return collapsed
+}
+
+// StructuredContext - the code of a context word at a signed offset, negative to the left.
+func StructuredContext(code int, offset int) int64 {
+	return int64(code)<<8 | int64(offset+MAXOFFSET+1)
+}
+
+// SplitStructuredContext - gets back the word code and the offset of a structured context.
+func SplitStructuredContext(context int64) (int, int) {
+	return int(context >> 8), int(context&0xff) - MAXOFFSET - 1
+}
+
+// Adds the structured contexts of a document with the weight of their offset in the window.
+func (c *Cooc) addStructured(encodedDoc []int, win Window) {
+	for offset := 1; offset <= len(win.lWeights) || offset <= len(win.rWeights); offset++ {
+		for i := offset; i < len(encodedDoc); i++ {
+			left, right := encodedDoc[i-offset], encodedDoc[i]
+			if left < 0 || right < 0 {
+				continue
+			}
+			if offset <= len(win.lWeights) && win.lWeights[offset-1] > 0 {
+				key := CantorPairing(int64(right), StructuredContext(left, -offset))
+				c.Counter[key] += win.lWeights[offset-1]
+			}
+			if offset <= len(win.rWeights) && win.rWeights[offset-1] > 0 {
+				key := CantorPairing(int64(left), StructuredContext(right, offset))
+				c.Counter[key] += win.rWeights[offset-1]
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+/* Random numbers that do not depend on the order in which the workers get documents:
+every sentence seeds its own generator from its document ID and its place in the document,
+so that repeated sentences still get draws of their own. */
+
+// Output function of splitmix64, see http://xoshiro.di.unimi.it/splitmix64.c
+func mix64(x uint64) uint64 {
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// A splitmix64 random number generator.
+type splitMix struct {
+	state uint64
+}
+
+// Seeds a generator for the sent-th sentence of the document with ID docID, see Corpus.DocID.
+func seedFromPlace(seed, docID int64, sent int) splitMix {
+	h := mix64(uint64(seed) + 0x9e3779b97f4a7c15)
+	h = mix64(h ^ uint64(docID))
+	return splitMix{mix64(h ^ uint64(sent))}
+}
+
+func (r *splitMix) next() uint64 {
+	r.state += 0x9e3779b97f4a7c15
+	return mix64(r.state)
+}
+
+// A float in [0, 1).
+func (r *splitMix) float() float64 {
+	return float64(r.next()>>11) / (1 << 53)
+}
+
+// SetSample - makes the unigram randomly drop frequent words when encoding documents, like
+// word2vec: a word with frequency f is dropped with probability 1-sqrt(t/f), before windowing.
+// The <OOV> token is sampled by the OOV count. A sentence is always sampled the same way for
+// the same seed and place in the corpus, whichever worker it goes to, see EncodeSentence.
+func (u *Unigram) SetSample(t float64, seed int64) {
+	if t < 0 {
+		panic(fmt.Sprintf("Sampling threshold %f cannot be negative!", t))
+	}
+	u.sampleSeed = seed
+	if t == 0 {
+		u.keep = nil
+		return
+	}
+	total := float64(u.oovCount)
+	for _, count := range u.counter {
+		total += float64(count)
+	}
+	keep := func(count int) float64 {
+		if count == 0 {
+			return 1
+		}
+		return math.Min(1, math.Sqrt(t/(float64(count)/total)))
+	}
+	u.keep = make([]float64, len(u.encoder)+1)
+	for code := range u.keep[:len(u.encoder)] {
+		u.keep[code] = keep(u.counter[code])
+	}
+	u.keep[len(u.encoder)] = keep(u.oovCount)
+}
+
+// Drops the frequent words of the sent-th sentence of document docID at random, in place.
+func (u *Unigram) subsample(codes []int, docID int64, sent int) []int {
+	rng := seedFromPlace(u.sampleSeed, docID, sent)
+	kept := codes[:0]
+	for _, code := range codes {
+		if code < 0 || rng.float() < u.keep[code] {
+			kept = append(kept, code)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/* Named window weighting schemes, giving the weight of a context d words away (1 <= d <= W). */
+
+// Builds the weights of one side of a window of size w from a scheme: "uniform", "linear"
+// ((W-d+1)/W, the weights of -w), "harmonic" (1/d, as in GloVe), "exp:R" (R^(d-1), R=0.5 by
+// default), "gauss:S" (exp(-(d-1)^2/2S^2), S=W/2 by default) or "expr:E" for an expression of d.
+func schemeWeights(scheme string, w int) []float32 {
+	name, param := scheme, ""
+	if i := strings.Index(scheme, ":"); i >= 0 {
+		name, param = scheme[:i], scheme[i+1:]
+	}
+	numParam := func(def float64) float64 {
+		if param == "" {
+			return def
+		}
+		x, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("Bad parameter for window scheme %s: %s", scheme, err))
+		}
+		return x
+	}
+
+	var weight func(d float64) float64
+	switch name {
+	case "uniform":
+		weight = func(d float64) float64 { return 1 }
+	case "linear":
+		// Computed just like MakeWindow, so that the weights are exactly the same.
+		weights := make([]float32, w)
+		for i := 0; i < w; i++ {
+			weights[i] = float32(w-i) / float32(w)
+		}
+		return weights
+	case "harmonic":
+		weight = func(d float64) float64 { return 1 / d }
+	case "exp":
+		r := numParam(0.5)
+		weight = func(d float64) float64 { return math.Pow(r, d-1) }
+	case "gauss":
+		sigma := numParam(float64(w) / 2)
+		weight = func(d float64) float64 { return math.Exp(-(d - 1) * (d - 1) / (2 * sigma * sigma)) }
+	case "expr":
+		expr := ParseWeightExpr(param)
+		weight = func(d float64) float64 { return expr(d, float64(w)) }
+	default:
+		panic(fmt.Sprintf("Window scheme %s is invalid!", scheme))
+	}
+
+	weights := make([]float32, w)
+	for i := range weights {
+		x := weight(float64(i + 1))
+		if x < 0 || math.IsNaN(x) || math.IsInf(x, 0) {
+			panic(fmt.Sprintf("Window scheme %s gives the invalid weight %f at distance %d!", scheme, x, i+1))
+		}
+		weights[i] = float32(x)
+	}
+	// A weight file cannot end with a zero, so neither can a scheme.
+	for len(weights) > 1 && weights[len(weights)-1] == 0 {
+		weights = weights[:len(weights)-1]
+	}
+	return weights
+}
+
+// MakeSchemeWindow - creates a Window of size w from a named scheme for both sides, or from
+// "LEFT,RIGHT" schemes for each side, see schemeWeights; it has the same weights as a window
+// file listing them. The linear scheme on both sides is the dynamic window of MakeWindow.
+func MakeSchemeWindow(w int, spec string) *Window {
+	if w <= 0 {
+		panic("Window schemes need a window size (-w W)!")
+	}
+	schemes := strings.Split(spec, ",")
+	if len(schemes) == 1 {
+		schemes = append(schemes, schemes[0])
+	}
+	if len(schemes) != 2 {
+		panic(fmt.Sprintf("Window schemes %s should be either one scheme or LEFT,RIGHT!", spec))
+	}
+	size := 0
+	if schemes[0] == "linear" && schemes[1] == "linear" {
+		size = w
+	}
+	return windowFromWeights(schemeWeights(schemes[0], w), schemeWeights(schemes[1], w), size)
+}
+
+/* Expressions of the distance d and the window size W, with numbers, + - * / ^ (power),
+parentheses and the functions exp, log and sqrt. */
+
+// WeightExpr - a compiled expression, evaluated at a distance and window size.
+type WeightExpr func(d, w float64) float64
+
+// A recursive descent parser for weight expressions.
+type exprParser struct {
+	src string
+	pos int
+}
+
+// ParseWeightExpr - compiles an expression like "1/d^0.5" or "exp(-d/W)".
+func ParseWeightExpr(src string) WeightExpr {
+	p := exprParser{src: src}
+	expr := p.sum()
+	if p.skipSpaces(); p.pos < len(p.src) {
+		p.fail("unexpected " + p.src[p.pos:])
+	}
+	return expr
+}
+
+func (p *exprParser) fail(msg string) {
+	panic(fmt.Sprintf("Bad window expression %q at %d: %s!", p.src, p.pos, msg))
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// Consumes the next character if it is one of chars.
+func (p *exprParser) accept(chars string) (byte, bool) {
+	p.skipSpaces()
+	if p.pos < len(p.src) && strings.IndexByte(chars, p.src[p.pos]) >= 0 {
+		p.pos++
+		return p.src[p.pos-1], true
+	}
+	return 0, false
+}
+
+// sum := product (("+" | "-") product)*
+func (p *exprParser) sum() WeightExpr {
+	expr := p.product()
+	for op, ok := p.accept("+-"); ok; op, ok = p.accept("+-") {
+		left, right := expr, p.product()
+		if op == '+' {
+			expr = func(d, w float64) float64 { return left(d, w) + right(d, w) }
+		} else {
+			expr = func(d, w float64) float64 { return left(d, w) - right(d, w) }
+		}
+	}
+	return expr
+}
+
+// product := unary (("*" | "/") unary)*
+func (p *exprParser) product() WeightExpr {
+	expr := p.unary()
+	for op, ok := p.accept("*/"); ok; op, ok = p.accept("*/") {
+		left, right := expr, p.unary()
+		if op == '*' {
+			expr = func(d, w float64) float64 { return left(d, w) * right(d, w) }
+		} else {
+			expr = func(d, w float64) float64 { return left(d, w) / right(d, w) }
+		}
+	}
+	return expr
+}
+
+// unary := "-" unary | power
+func (p *exprParser) unary() WeightExpr {
+	if _, ok := p.accept("-"); ok {
+		inner := p.unary()
+		return func(d, w float64) float64 { return -inner(d, w) }
+	}
+	return p.power()
+}
+
+// power := atom ("^" unary)?, so that "2^-d" works and "d^2^3" is d^(2^3).
+func (p *exprParser) power() WeightExpr {
+	base := p.atom()
+	if _, ok := p.accept("^"); ok {
+		exponent := p.unary()
+		return func(d, w float64) float64 { return math.Pow(base(d, w), exponent(d, w)) }
+	}
+	return base
+}
+
+var exprFuncs = map[string]func(float64) float64{
+	"exp":  math.Exp,
+	"log":  math.Log,
+	"sqrt": math.Sqrt,
+}
+
+// atom := number | "d" | "W" | function "(" sum ")" | "(" sum ")"
+func (p *exprParser) atom() WeightExpr {
+	if _, ok := p.accept("("); ok {
+		inner := p.sum()
+		if _, ok := p.accept(")"); !ok {
+			p.fail("missing )")
+		}
+		return inner
+	}
+	start := p.pos
+	for p.pos < len(p.src) && (isExprLetter(p.src[p.pos]) || p.src[p.pos] == '.' || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+		p.pos++
+	}
+	token := p.src[start:p.pos]
+	switch {
+	case token == "":
+		p.fail("expected a number, d, W, a function or (")
+	case token == "d":
+		return func(d, w float64) float64 { return d }
+	case token == "W":
+		return func(d, w float64) float64 { return w }
+	case exprFuncs[token] != nil:
+		f := exprFuncs[token]
+		if _, ok := p.accept("("); !ok {
+			p.fail("expected ( after " + token)
+		}
+		inner := p.sum()
+		if _, ok := p.accept(")"); !ok {
+			p.fail("missing )")
+		}
+		return func(d, w float64) float64 { return f(inner(d, w)) }
+	}
+	x, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		p.fail("unknown " + token)
+	}
+	return func(d, w float64) float64 { return x }
+}
+
+func isExprLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
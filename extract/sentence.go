@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Common abbreviations that end in a period without ending the sentence.
+var defaultAbbrevs = []string{
+	"mr.", "mrs.", "ms.", "dr.", "prof.", "sr.", "jr.", "st.", "mt.", "gen.", "gov.",
+	"sen.", "rep.", "rev.", "capt.", "col.", "lt.", "sgt.", "inc.", "ltd.", "co.",
+	"corp.", "dept.", "univ.", "vs.", "etc.", "e.g.", "i.e.", "cf.", "al.", "approx.",
+	"no.", "vol.", "fig.", "p.", "pp.", "ed.", "eds.", "jan.", "feb.", "mar.", "apr.",
+	"jun.", "jul.", "aug.", "sep.", "sept.", "oct.", "nov.", "dec.", "u.s.", "u.k.",
+}
+
+// Characters that may close a sentence after its terminal punctuation, e.g. `."` or `!)`.
+const sentenceClosers = "\"')]}’”»"
+
+// Characters that may open a word before it, e.g. `("Dr.`.
+const wordOpeners = "\"'([{‘“«"
+
+// SentenceSplitter - rule-based splitter of documents into sentences.
+// Sentences end at words ending in terminal punctuation (., ! or ?), unless the word is
+// a known abbreviation or an initial; or, in lines mode, sentences are just lines.
+type SentenceSplitter struct {
+	abbrevs map[string]bool
+	lines   bool
+}
+
+// MakeSentenceSplitter - creates a splitter given its mode, "rules" or "lines",
+// and an optional path to a file of abbreviations (one per line) to use instead of the defaults.
+func MakeSentenceSplitter(mode, abbrevPath string) *SentenceSplitter {
+	if mode != "rules" && mode != "lines" {
+		panic(fmt.Sprintf("Sentence splitting mode %s is invalid!", mode))
+	}
+	abbrevs := defaultAbbrevs
+	if abbrevPath != "" {
+		bytes, err := ioutil.ReadFile(abbrevPath)
+		if err != nil {
+			panic(err)
+		}
+		abbrevs = strings.Fields(string(bytes))
+	}
+	s := SentenceSplitter{abbrevs: make(map[string]bool, len(abbrevs)), lines: mode == "lines"}
+	for _, abbrev := range abbrevs {
+		s.abbrevs[strings.ToLower(strings.TrimSuffix(abbrev, "."))+"."] = true
+	}
+	return &s
+}
+
+// Mode - the mode the splitter was made with, "rules" or "lines".
+func (s *SentenceSplitter) Mode() string {
+	if s.lines {
+		return "lines"
+	}
+	return "rules"
+}
+
+// Whether a whitespace-delimited word ends its sentence.
+func (s *SentenceSplitter) endsSentence(word string) bool {
+	word = strings.TrimRight(word, sentenceClosers)
+	if strings.HasSuffix(word, "!") || strings.HasSuffix(word, "?") {
+		return true
+	}
+	if !strings.HasSuffix(word, ".") {
+		return false
+	}
+	if strings.HasSuffix(word, "...") {
+		return true
+	}
+	word = strings.ToLower(strings.TrimLeft(word, wordOpeners))
+	if s.abbrevs[word] {
+		return false
+	}
+	// Initials like the "J." in "J. Smith".
+	if r, size := utf8.DecodeRuneInString(word); size+1 == len(word) && unicode.IsLetter(r) {
+		return false
+	}
+	return true
+}
+
+// Split - splits a document into its sentences.
+func (s *SentenceSplitter) Split(doc string) []string {
+	if s.lines {
+		return strings.Split(doc, "\n")
+	}
+	var sents []string
+	start, wordStart := 0, -1
+	for i, r := range doc {
+		if !unicode.IsSpace(r) {
+			if wordStart < 0 {
+				wordStart = i
+			}
+			continue
+		}
+		if wordStart >= 0 && s.endsSentence(doc[wordStart:i]) {
+			sents = append(sents, doc[start:i])
+			start = i
+		}
+		wordStart = -1
+	}
+	return append(sents, doc[start:])
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestSentenceSplitter(t *testing.T) {
+	s := MakeSentenceSplitter("rules", "")
+	doc := `Dr. Smith met J. Doe in the U.S. yesterday. "Was it fun?" she asked! It was... fine (e.g. not great).`
+	expected := []string{
+		"Dr. Smith met J. Doe in the U.S. yesterday.",
+		` "Was it fun?"`,
+		" she asked!",
+		" It was...",
+		" fine (e.g. not great).",
+	}
+	sents := s.Split(doc)
+	if len(sents) != len(expected) {
+		t.Fatalf("Expected %d sentences but got %d: %q\n", len(expected), len(sents), sents)
+	}
+	for i := range sents {
+		if sents[i] != expected[i] {
+			t.Errorf("Expected sentence %q but got %q\n", expected[i], sents[i])
+		}
+	}
+
+	lines := MakeSentenceSplitter("lines", "")
+	if sents := lines.Split("one sentence\nanother one"); len(sents) != 2 {
+		t.Errorf("Lines mode should give 2 sentences but got %q\n", sents)
+	}
+}
+
+func TestParseSentences(t *testing.T) {
+	p := ConstructParser()
+	p.SetNormalizer(MakeNormalizer("digits", ""))
+	p.SetSentenceSplitter(MakeSentenceSplitter("rules", ""))
+	sents := p.ParseSentences("I have 2 cats.  They sleep!  ")
+	if len(sents) != 2 || len(sents[0]) != 4 || sents[0][2] != "0" || sents[1][1] != "sleep!" {
+		t.Errorf("Bad sentence parsing, got %q\n", sents)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// GAPCODE - code for a filtered word that still takes up its place in a window;
+// cooccurrences with it are never counted.
+const GAPCODE = -2
+
+// Built-in stopword lists, used by name instead of a file.
+var builtinStopwords = map[string]string{
+	"english": `a about above after again against all am an and any are as at be because been
+before being below between both but by can could did do does doing down during each few for
+from further had has have having he her here hers herself him himself his how i if in into is
+it its itself just me more most my myself no nor not now of off on once only or other our ours
+ourselves out over own same she should so some such than that the their theirs them themselves
+then there these they this those through to too under until up very was we were what when
+where which while who whom why will with would you your yours yourself yourselves`,
+}
+
+// LoadStopwords - loads the words of a built-in stopword list ("english"), or of a file
+// with words separated by whitespace, where lines starting with # are comments.
+func LoadStopwords(nameOrPath string) []string {
+	if list, ok := builtinStopwords[nameOrPath]; ok {
+		return strings.Fields(list)
+	}
+	bytes, err := ioutil.ReadFile(nameOrPath)
+	if err != nil {
+		panic(err)
+	}
+	var words []string
+	for _, line := range strings.Split(string(bytes), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			words = append(words, strings.Fields(line)...)
+		}
+	}
+	return words
+}
+
+// SetStopwords - makes the unigram filter out the given words when encoding documents.
+// In "clean" mode they are removed before the window slides over the document, so it
+// reaches further; in "dirty" mode they are replaced by GAPCODE and still count toward
+// the distance between words. Stopwords that are OOV are handled like other OOV words.
+func (u *Unigram) SetStopwords(words []string, mode string) {
+	switch mode {
+	case "clean":
+		u.stopGaps = false
+	case "dirty":
+		u.stopGaps = true
+	default:
+		panic(fmt.Sprintf("Stopword mode %s is invalid, need clean or dirty!", mode))
+	}
+	u.stop = make(map[int]bool, len(words))
+	for _, word := range words {
+		if code, oov := u.Encode(word); !oov {
+			u.stop[code] = true
+		}
+	}
+}
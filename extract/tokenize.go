@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+)
+
+// Tokenizer - splits text into tokens.
+type Tokenizer interface {
+	Tokenize(text string) []string
+	Name() string // the specification it was made from, recorded with the unigram.
+}
+
+// MakeTokenizer - creates a Tokenizer from its specification; one of
+// "whitespace" (tokens are separated by whitespace), "regex:PATTERN" (tokens are the
+// matches of PATTERN), or "unicode" (Unicode word boundaries, without punctuation).
+func MakeTokenizer(spec string) Tokenizer {
+	switch {
+	case spec == "whitespace":
+		return WhitespaceTokenizer{}
+	case strings.HasPrefix(spec, "regex:"):
+		return RegexTokenizer{regexp.MustCompile(strings.TrimPrefix(spec, "regex:"))}
+	case spec == "unicode":
+		return UnicodeTokenizer{}
+	}
+	panic(fmt.Sprintf("Tokenizer %s is invalid!", spec))
+}
+
+// WhitespaceTokenizer - tokens are whatever is between whitespace.
+type WhitespaceTokenizer struct{}
+
+// Tokenize - splits text at whitespace.
+func (t WhitespaceTokenizer) Tokenize(text string) []string {
+	return strings.Fields(text)
+}
+
+// Name - of the tokenizer.
+func (t WhitespaceTokenizer) Name() string {
+	return "whitespace"
+}
+
+// RegexTokenizer - tokens are the matches of a regexp.
+type RegexTokenizer struct {
+	re *regexp.Regexp
+}
+
+// Tokenize - finds all matches in text; whitespace inside a match splits it further,
+// since tokens can never contain whitespace.
+func (t RegexTokenizer) Tokenize(text string) []string {
+	var tokens []string
+	for _, match := range t.re.FindAllString(text, -1) {
+		tokens = append(tokens, strings.Fields(match)...)
+	}
+	return tokens
+}
+
+// Name - of the tokenizer.
+func (t RegexTokenizer) Name() string {
+	return "regex:" + t.re.String()
+}
+
+// UnicodeTokenizer - tokens are the words between Unicode word boundaries (UAX #29),
+// leaving out the segments that are only whitespace or punctuation.
+type UnicodeTokenizer struct{}
+
+// Whether a segment has anything other than whitespace and punctuation.
+func isWordSegment(segment string) bool {
+	for _, r := range segment {
+		if !unicode.IsSpace(r) && !unicode.IsPunct(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tokenize - segments text at word boundaries.
+func (t UnicodeTokenizer) Tokenize(text string) []string {
+	var tokens []string
+	state := -1
+	var segment string
+	for len(text) > 0 {
+		segment, text, state = uniseg.FirstWordInString(text, state)
+		if isWordSegment(segment) {
+			tokens = append(tokens, segment)
+		}
+	}
+	return tokens
+}
+
+// Name - of the tokenizer.
+func (t UnicodeTokenizer) Name() string {
+	return "unicode"
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestTokenizers(t *testing.T) {
+	text := `The dog, "Rex", can't sit—it's 3.5 m tall!`
+	expected := map[string][]string{
+		"whitespace": {"The", "dog,", `"Rex",`, "can't", "sit—it's", "3.5", "m", "tall!"},
+		`regex:\w+`:  {"The", "dog", "Rex", "can", "t", "sit", "it", "s", "3", "5", "m", "tall"},
+		"unicode":    {"The", "dog", "Rex", "can't", "sit", "it's", "3.5", "m", "tall"},
+	}
+	for spec, tokens := range expected {
+		tokenizer := MakeTokenizer(spec)
+		if tokenizer.Name() != spec {
+			t.Errorf("Tokenizer %s is named %s!\n", spec, tokenizer.Name())
+		}
+		got := tokenizer.Tokenize(text)
+		if len(got) != len(tokens) {
+			t.Errorf("Tokenizer %s: expected %q but got %q\n", spec, tokens, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tokens[i] {
+				t.Errorf("Tokenizer %s: expected token %q but got %q\n", spec, tokens[i], got[i])
+			}
+		}
+	}
+
+	// Tokens never have whitespace in them, or they would corrupt the unigram file.
+	if got := MakeTokenizer(`regex:\w+ \w+`).Tokenize("new york city"); len(got) != 2 {
+		t.Errorf("Regex matches with spaces should be split, got %q\n", got)
+	}
+}
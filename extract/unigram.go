@@ -6,13 +6,30 @@ import (
 	"sort"
 )
 
+// Parser settings assumed for unigrams that do not record them, i.e., older ones.
+var defaultUnigramConfig = map[string]string{
+	"gazetteer":    "none",
+	"normalize":    "none",
+	"phrases":      "none",
+	"placeholders": "none",
+	"sentences":    "none",
+	"tokenizer":    "whitespace",
+}
+
 // Unigram - a dictionary struct that is sortable by counts.
 type Unigram struct {
-	encoder  map[string]int
-	decoder  map[int]string
-	counter  map[int]int
-	idx      []int
-	oovCount int
+	encoder    map[string]int
+	decoder    map[int]string
+	counter    map[int]int
+	idx        []int
+	oovCount   int
+	checksum   string            // checksum of the file the unigram was loaded from, if any.
+	config     map[string]string // settings of the parser its words came from.
+	stop       map[int]bool      // codes filtered out when encoding, see SetStopwords.
+	stopGaps   bool              // whether stopwords leave a GAPCODE behind.
+	oovMode    string            // what becomes of OOV words when encoding, see SetOOVMode.
+	keep       []float64         // probability of keeping each code when subsampling, see SetSample.
+	sampleSeed int64
 }
 
 func (u *Unigram) addStr(str string, count int) {
@@ -55,11 +72,50 @@ func (u *Unigram) Encode(str string) (int, bool) {
 
 // Merge - Unigram u eats another Unigram u2.
 func (u *Unigram) Merge(u2 *Unigram) {
+	if diff := ConfigMismatch(u.config, u2.config); diff != "" {
+		panic(fmt.Sprintf("Cannot merge unigrams parsed differently, %s!", diff))
+	}
 	for str, code2 := range u2.encoder {
 		u.addStr(str, u2.counter[code2])
 	}
 }
 
+// UNKNOWNSETTING - a parser setting that was not recorded, which matches any other.
+const UNKNOWNSETTING = "unknown"
+
+// Gets a parser setting from a config, falling back to its default.
+func configValue(config map[string]string, key string) string {
+	if value, ok := config[key]; ok {
+		return value
+	}
+	return defaultUnigramConfig[key]
+}
+
+// ConfigMismatch - describes the first difference between two parser configs, or "" if none.
+func ConfigMismatch(c1, c2 map[string]string) string {
+	var keys []string
+	for _, config := range []map[string]string{c1, c2, defaultUnigramConfig} {
+		for key := range config {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v1, v2 := configValue(c1, key), configValue(c2, key)
+		if v1 != v2 && v1 != UNKNOWNSETTING && v2 != UNKNOWNSETTING {
+			return fmt.Sprintf("%s is %q vs %q", key, v1, v2)
+		}
+	}
+	return ""
+}
+
+// CheckParser - panics unless the parser gives words the same way as the one the unigram came from.
+func (u *Unigram) CheckParser(p *Parser) {
+	if diff := ConfigMismatch(u.config, p.Config()); diff != "" {
+		panic(fmt.Sprintf("Parser does not match the unigram, %s!", diff))
+	}
+}
+
 /*****  Sorting interface *****/
 func (u Unigram) Swap(i, j int) {
 	u.idx[i], u.idx[j] = u.idx[j], u.idx[i]
@@ -154,10 +210,73 @@ func FilterUnigram(u *Unigram, maxVocabSize int) (fu *Unigram) {
 		fu.counter[newCode] = u.counter[oldCode]
 	}
 	fu.oovCount = oovCount
+	fu.config = u.config
 	return
 }
 
-// UnigramEncode - encodes a string list into the unigram codes.
+// EncodeDoc - encodes a single document into the unigram codes, handling OOV words
+// according to the OOV mode, filtering stopwords and subsampling, see FilterEncoded.
+// It is subsampled as the first document of the corpus, see EncodeSentence.
+func (u *Unigram) EncodeDoc(doc []string) []int {
+	return u.EncodeSentence(doc, 0, 0)
+}
+
+// EncodeSentence - encodes the sent-th sentence of the document with ID docID like EncodeDoc,
+// subsampling it with the random numbers of its place in the corpus.
+func (u *Unigram) EncodeSentence(words []string, docID int64, sent int) []int {
+	return u.FilterEncoded(u.EncodeDocKeepOOV(words), docID, sent)
+}
+
+// EncodeDocKeepOOV - encodes a single document into the unigram codes, with OOVCODE for OOV words.
+func (u *Unigram) EncodeDocKeepOOV(doc []string) []int {
+	codes := make([]int, len(doc))
+	for i, word := range doc {
+		if code, oov := u.Encode(word); !oov {
+			codes[i] = code
+		} else {
+			codes[i] = OOVCODE
+		}
+	}
+	return codes
+}
+
+// SetOOVMode - sets what becomes of OOV words when encoding documents: "purge" (the default)
+// removes them, so that the words around them look closer than they are; "gap" replaces them
+// by GAPCODE, so that they take up their place in windows without being counted; and "token"
+// counts them all as the <OOV> word, whose code is the size of the vocabulary.
+func (u *Unigram) SetOOVMode(mode string) {
+	if mode != "purge" && mode != "gap" && mode != "token" {
+		panic(fmt.Sprintf("OOV mode %s is invalid, need purge, gap or token!", mode))
+	}
+	u.oovMode = mode
+}
+
+// FilterEncoded - handles the OOV words of a document encoded with OOVCODE according to
+// the OOV mode, filters its stopwords and subsamples it as the sent-th sentence of the
+// document with ID docID, in place.
+func (u *Unigram) FilterEncoded(codes []int, docID int64, sent int) []int {
+	kept := codes[:0]
+	for _, code := range codes {
+		switch {
+		case code == OOVCODE && u.oovMode == "gap":
+			kept = append(kept, GAPCODE)
+		case code == OOVCODE && u.oovMode == "token":
+			kept = append(kept, len(u.encoder))
+		case code == OOVCODE:
+		case u.stop[code] && u.stopGaps:
+			kept = append(kept, GAPCODE)
+		case u.stop[code]:
+		default:
+			kept = append(kept, code)
+		}
+	}
+	if u.keep != nil {
+		return u.subsample(kept, docID, sent)
+	}
+	return kept
+}
+
+// UnigramEncode - encodes a string list into the unigram codes, see EncodeDoc.
 func UnigramEncode(u *Unigram, documents [][]string) [][]int {
 	encodedDocs := make([][]int, len(documents))
 	ch := make(chan []int, BUFFERSIZE)
@@ -176,14 +295,7 @@ func UnigramEncode(u *Unigram, documents [][]string) [][]int {
 	// Speaker, puts the idx in there to always retain order!
 	for d, document := range documents {
 		go func(idx int, doc []string) {
-			codes := make([]int, 0, len(doc)+1)
-			for _, word := range doc {
-				// Purge OOV words!
-				if code, oov := u.Encode(word); !oov {
-					codes = append(codes, code)
-				}
-			}
-			codes = append(codes, idx)
+			codes := append(u.EncodeSentence(doc, int64(idx), 0), idx)
 			ch <- codes
 		}(d, document)
 	}
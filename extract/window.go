@@ -1,5 +1,7 @@
 package main
 
+import "fmt"
+
 /* Window struct for help in having generalized windows. */
 
 // Window - allows for arbitrarily defined context windows.
@@ -8,6 +10,119 @@ type Window struct {
 	rWeights []float32
 	rstart   int
 	lstart   int
+	cross    float32 // weight of contexts across sentences, relative to within a sentence.
+	size     int     // W of a dynamic window, 0 if its weights were loaded from a file.
+	sampled  bool    // whether contexts are within a window size drawn for each word.
+	unit     float32 // weight of each context of a sampled or positional window.
+	seed     int64
+	// whether contexts are counted at each offset, rather than weighted together.
+	positional bool
+	// whether contexts on the left are counted apart from those on the right.
+	directional bool
+	// whether contexts are words at an offset, like "cat@-2".
+	structured bool
+	// "doc" or "termdoc" if the context is the whole document, see MakeDocumentWindow.
+	document string
+}
+
+// SetCrossWeight - sets the weight of contexts across sentence boundaries, in [0, 1];
+// 0 (the default) means that the window never crosses the end of a sentence.
+func (w *Window) SetCrossWeight(cross float32) {
+	if cross < 0 || cross > 1 {
+		panic(fmt.Sprintf("Cross-sentence weight %f is not in [0, 1]!", cross))
+	}
+	w.cross = cross
+}
+
+// Panics if the window is a whole document rather than a sliding window.
+func (w *Window) checkSliding() {
+	if w.document != "" {
+		panic("Document contexts cannot be sampled, positional, directional or structured!")
+	}
+}
+
+// SetSampled - makes a dynamic window draw a size b in [1, W] for each word, and count its
+// contexts within b words with weight 1, like word2vec does, instead of weighting a context
+// d words away by its expected weight (W-d+1)/W. Each sentence draws its sizes from its own
+// random numbers, seeded from seed and its place in the corpus, see Cooc.AddSentence.
+func (w *Window) SetSampled(seed int64) {
+	w.checkSliding()
+	if w.size == 0 {
+		panic("Only dynamic windows (-w W, or -scheme linear) can be sampled!")
+	}
+	if w.positional || w.structured {
+		panic("Positional and structured windows cannot be sampled!")
+	}
+	w.sampled, w.seed = true, seed
+}
+
+// SetPositional - makes the window count each context at its offset, from -L to +R for a
+// window with L weights on the left and R on the right, rather than adding up the weights
+// of all offsets; the weights can be applied later on with Collapse.
+func (w *Window) SetPositional() {
+	w.checkSliding()
+	if len(w.lWeights) > MAXOFFSET || len(w.rWeights) > MAXOFFSET {
+		panic(fmt.Sprintf("Positional windows can only reach %d words away!", MAXOFFSET))
+	}
+	if w.sampled {
+		panic("Sampled windows cannot be positional!")
+	}
+	if w.directional {
+		panic("Positional windows already keep contexts on each side apart!")
+	}
+	w.positional = true
+}
+
+// SetDirectional - makes the window count the contexts on the left of words apart from
+// those on their right, see SplitDirections.
+func (w *Window) SetDirectional() {
+	w.checkSliding()
+	if w.positional {
+		panic("Positional windows already keep contexts on each side apart!")
+	}
+	w.directional = true
+}
+
+// SetStructured - makes the window count contexts as a word at an offset, like "cat@-2",
+// weighted by the window's weight for that offset.
+func (w *Window) SetStructured() {
+	w.checkSliding()
+	if len(w.lWeights) > MAXOFFSET || len(w.rWeights) > MAXOFFSET {
+		panic(fmt.Sprintf("Structured windows can only reach %d words away!", MAXOFFSET))
+	}
+	if w.sampled || w.positional || w.directional {
+		panic("Structured windows cannot be sampled, positional or directional!")
+	}
+	w.structured = true
+}
+
+// CoocMode - the mode of the Coocs counted with the window, see Cooc.
+func (w *Window) CoocMode() string {
+	if w.positional {
+		return "positional"
+	}
+	if w.directional {
+		return "directional"
+	}
+	if w.structured {
+		return "structured"
+	}
+	return w.document
+}
+
+// Makes a copy of the window with all of its weights multiplied by f.
+func (w *Window) scaled(f float32) Window {
+	scaled := *w
+	scaled.unit = f * w.unit
+	scaled.lWeights = make([]float32, len(w.lWeights))
+	scaled.rWeights = make([]float32, len(w.rWeights))
+	for i, weight := range w.lWeights {
+		scaled.lWeights[i] = f * weight
+	}
+	for i, weight := range w.rWeights {
+		scaled.rWeights[i] = f * weight
+	}
+	return scaled
 }
 
 // GetLeftStartEnd - gets the left start and end idxs of the Window
@@ -31,7 +146,9 @@ func MakeWindow(w int, wPath string) *Window {
 	)
 
 	// Integer-based weighting (dynamic only.)
+	size := 0
 	if w != -1 {
+		size = w
 		weights := make([]float32, w)
 		for i := 0; i < w; i++ {
 			weights[i] = float32(w-i) / float32(w)
@@ -42,7 +159,11 @@ func MakeWindow(w int, wPath string) *Window {
 		lWeights, rWeights = LoadCustomWeights(wPath)
 	}
 
-	// Finally...
+	return windowFromWeights(lWeights, rWeights, size)
+}
+
+// Builds a Window out of the weights of each side, skipping the leading zeros.
+func windowFromWeights(lWeights, rWeights []float32, size int) *Window {
 	l := 0
 	for l < len(lWeights) && lWeights[l] == 0 {
 		l++
@@ -55,6 +176,8 @@ func MakeWindow(w int, wPath string) *Window {
 		lWeights: lWeights,
 		rWeights: rWeights,
 		lstart:   l,
-		rstart:   r}
+		rstart:   r,
+		size:     size,
+		unit:     1}
 	return &win
 }
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"math"
+	"strings"
 	"testing"
 )
 
@@ -102,3 +105,41 @@ func TestCustomWeighting(t *testing.T) {
 	// field := []float32{0.5, 1, 0.5, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 	// 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0.5, 1, 0.5}
 }
+
+func TestSchemeWeighting(t *testing.T) {
+	// The linear scheme is what -w gives, and what its weight file gives.
+	WindowsEqualTest(MakeSchemeWindow(10, "linear"), MakeWindow(-1, "../data/test_data/sample_w10.w"), t)
+
+	// Each side has its own scheme.
+	win := MakeSchemeWindow(4, "harmonic,uniform")
+	WindowValidate([]float32{1, 0.5, float32(1.0 / 3), 0.25, 1, 1, 1, 1}, win, t)
+	WindowsEqualTest(win, MakeSchemeWindow(4, "expr:1/d,expr:d/d"), t)
+	WindowsEqualTest(MakeSchemeWindow(3, "exp:0.5"), MakeSchemeWindow(3, "expr:2^-(d-1)"), t)
+	WindowsEqualTest(MakeSchemeWindow(3, "gauss:2"), MakeSchemeWindow(3, "expr:exp(-(d-1)^2/(2*2^2))"), t)
+	if w := MakeSchemeWindow(4, "expr:1/d^0.5").lWeights[3]; w != 0.5 {
+		t.Errorf("Expected 1/sqrt(4) = 0.5, got %f\n", w)
+	}
+
+	// A scheme makes the same window as a file listing its weights.
+	win = MakeSchemeWindow(5, "gauss,expr:(W-d)/W")
+	var lines []string
+	for _, weights := range [][]float32{win.lWeights, win.rWeights} {
+		var strs []string
+		for _, w := range weights {
+			strs = append(strs, fmt.Sprint(w))
+		}
+		lines = append(lines, strings.Join(strs, " "))
+	}
+	path := writeCorpusFile(t, "gauss.w", strings.Join(lines, "\n")+"\n")
+	if len(win.rWeights) != 4 || math.Abs(float64(win.rWeights[0])-0.8) > 1e-6 {
+		t.Errorf("Trailing zero weights should be dropped, got %v\n", win.rWeights)
+	}
+	WindowsEqualTest(win, MakeWindow(-1, path), t)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Should not accept a malformed expression!")
+		}
+	}()
+	MakeSchemeWindow(5, "expr:1/(d")
+}